@@ -1,6 +1,6 @@
 module github.com/landrisek/cisco
 
-go 1.20
+go 1.21
 
 require ()
 
@@ -0,0 +1,4 @@
+export GO111MODULE="on"
+export GOPATH="$HOME/go"
+
+go run ./src/main.go -stats
\ No newline at end of file
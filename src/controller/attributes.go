@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// attributePrefix starts query parameters filtering tags by their attributes, e.g. attr.owner=team-a.
+const attributePrefix = "attr."
+
+// attributeFilter is one attr.* query parameter, path is the key split by dots to reach into objects
+// like attr.translations.de=Hund. A tag matches when its attribute equals any of values.
+type attributeFilter struct {
+	path   []string
+	values []string
+}
+
+// parseAttributeFilters reads attr.* query parameters. Different parameters have to match all,
+// a parameter given more times matches any of its values and an empty value matches any value.
+func parseAttributeFilters(parameters url.Values) ([]attributeFilter, error) {
+	var filters []attributeFilter
+	for key, values := range parameters {
+		if !strings.HasPrefix(key, attributePrefix) {
+			continue
+		}
+		path := strings.Split(strings.TrimPrefix(key, attributePrefix), ".")
+		for _, part := range path {
+			if part == "" {
+				return nil, fmt.Errorf("parameter %s does not name an attribute", key)
+			}
+		}
+		filters = append(filters, attributeFilter{path: path, values: values})
+	}
+	return filters, nil
+}
+
+// matches reports whether the tag has the attribute with one of the values.
+func (f attributeFilter) matches(node repository.GNode) bool {
+	value, ok := lookupAttribute(node, f.path)
+	if !ok {
+		return false
+	}
+	texts := attributeTexts(value)
+	for _, expected := range f.values {
+		if expected == "" || slices.Contains(texts, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupAttribute returns the attribute of the node, following the path into objects.
+func lookupAttribute(node repository.GNode, path []string) (interface{}, bool) {
+	attributed, ok := node.(attributed)
+	if !ok {
+		return nil, false
+	}
+	var value interface{} = attributed.GetAttributes()
+	for _, key := range path {
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// attributeTexts returns an attribute loaded from JSON as texts to compare with query parameters,
+// an array gives a text for each of its elements and objects give none.
+func attributeTexts(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case float64:
+		return []string{strconv.FormatFloat(value, 'f', -1, 64)}
+	case bool:
+		return []string{strconv.FormatBool(value)}
+	case []interface{}:
+		var texts []string
+		for _, element := range value {
+			texts = append(texts, attributeTexts(element)...)
+		}
+		return texts
+	}
+	return nil
+}
+
+// filterByAttributes returns a copy of the subtree with tags matching all filters and their ancestors,
+// the requested tag stays the root even when it does not match. Without filters the subtree is returned
+// as it is. The tree being served is not modified.
+func filterByAttributes(node repository.GNode, filters []attributeFilter) repository.GNode {
+	if len(filters) == 0 {
+		return node
+	}
+	filtered, found := repository.Filter(node, func(tag repository.GNode) bool {
+		for _, filter := range filters {
+			if !filter.matches(tag) {
+				return false
+			}
+		}
+		return true
+	})
+	if !found {
+		return repository.Prune(node, 0)
+	}
+	return filtered
+}
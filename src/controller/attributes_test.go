@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+const attributedTags = `{"name": "animals", "id": "a1", "children": [
+	{"name": "dogs", "id": "d1", "description": "Loyal", "aliases": ["canines", "hounds"], "translations": {"de": "Hunde"}, "legs": 4, "children": [
+		{"name": "puppies", "id": "p1", "young": true}
+	]},
+	{"name": "cats", "id": "c1", "aliases": ["felines"], "translations": {"de": "Katzen"}, "legs": 4},
+	{"name": "birds", "id": "b1", "attributes": {"legs": 2}}
+]}`
+
+// Attributes survive loading and marshaling, written next to the name in order of their keys.
+func TestUploadAttributes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tags.json")
+	if err := os.WriteFile(file, []byte(attributedTags), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := UploadJson(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := root.(repository.MyNode)
+	body, err := node.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"name":"animals","id":"a1","children":[` +
+		`{"name":"dogs","aliases":["canines","hounds"],"description":"Loyal","id":"d1","legs":4,"translations":{"de":"Hunde"},"children":[` +
+		`{"name":"puppies","id":"p1","young":true,"children":null}]},` +
+		`{"name":"cats","aliases":["felines"],"id":"c1","legs":4,"translations":{"de":"Katzen"},"children":null},` +
+		`{"name":"birds","id":"b1","legs":2,"children":null}]}`
+	if string(body) != expected {
+		t.Errorf("Expected %s, but got %s", expected, body)
+	}
+
+	for _, content := range []string{
+		`{"name": "animals", "aliases": "dogs"}`,
+		`{"name": "animals", "translations": {"de": 1}}`,
+		`{"name": "animals", "id": 1}`,
+		`{"name": "animals", "legs": 4, "attributes": {"legs": 2}}`,
+		`{"name": "animals", "attributes": {"children": []}}`,
+	} {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := UploadJson(file); err == nil {
+			t.Errorf("Expected error for %s", content)
+		}
+	}
+}
+
+func TestFilterByAttributes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tags.json")
+	if err := os.WriteFile(file, []byte(attributedTags), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := UploadJson(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := tagServer{tags: newTagStore(root, "")}
+
+	testCases := []struct {
+		name           string
+		filters        string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Test no filter", filters: "", expectedStatus: http.StatusOK, expectedBody: "animals dogs puppies cats birds"},
+		{name: "Test string", filters: "attr.id=c1", expectedStatus: http.StatusOK, expectedBody: "animals cats"},
+		{name: "Test number", filters: "attr.legs=4", expectedStatus: http.StatusOK, expectedBody: "animals dogs cats"},
+		{name: "Test alias", filters: "attr.aliases=hounds", expectedStatus: http.StatusOK, expectedBody: "animals dogs"},
+		{name: "Test translation", filters: "attr.translations.de=Katzen", expectedStatus: http.StatusOK, expectedBody: "animals cats"},
+		{name: "Test any value", filters: "attr.young=", expectedStatus: http.StatusOK, expectedBody: "animals dogs puppies"},
+		{name: "Test more values", filters: "attr.id=b1&attr.id=p1", expectedStatus: http.StatusOK, expectedBody: "animals dogs puppies birds"},
+		{name: "Test all filters", filters: "attr.legs=4&attr.aliases=felines", expectedStatus: http.StatusOK, expectedBody: "animals cats"},
+		{name: "Test no match", filters: "attr.id=x", expectedStatus: http.StatusOK, expectedBody: "animals"},
+		{name: "Test invalid parameter", filters: "attr.=x", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/taggedContent?tag=animals&token="+url.QueryEscape(repository.GetValidToken())+"&"+tc.filters, nil)
+			request.Header.Set("Accept", "application/x-ndjson")
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+			if recorder.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, but got %d", tc.expectedStatus, recorder.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if actual := ndjsonNames(t, recorder.Body.Bytes()); actual != tc.expectedBody {
+				t.Errorf("Expected tags %s, but got %s", tc.expectedBody, actual)
+			}
+		})
+	}
+}
+
+// ndjsonNames returns names of tags in NDJSON lines separated by spaces.
+func ndjsonNames(t *testing.T, body []byte) string {
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		var tag struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(line), &tag); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, tag.Name)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// Config holds the settings of the server started by RestAPI.
+type Config struct {
+	// TagsFile is the file the tags were loaded from. When set, it is watched for changes
+	// and re-parsed on change or on SIGHUP without restarting the server.
+	TagsFile string
+	// ReloadInterval is how often the TagsFile is checked for changes.
+	ReloadInterval time.Duration
+	// ShutdownDelay is how long the server keeps serving after it reported not ready on shutdown,
+	// giving load balancers time to stop routing to it.
+	ShutdownDelay time.Duration
+	// DrainTimeout is how long requests in flight may take to finish on shutdown before they are canceled.
+	DrainTimeout time.Duration
+	// Host and Port are the address the server binds to. Use host 0.0.0.0 inside a container.
+	Host string
+	Port int
+	// CertFile and KeyFile switch the server to TLS. Files are re-read when they are rotated on disk.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS, client certificates are verified against this CA bundle.
+	ClientCAFile string
+	// RequireClientCert rejects TLS connections without a valid client certificate,
+	// otherwise clients without certificate can still authenticate with a token.
+	RequireClientCert bool
+	// ClientIdentities maps a client certificate subject (common name, DNS or URI SAN) to the identity
+	// it authenticates as. Only mapped certificates are authenticated without a token.
+	ClientIdentities map[string]string
+	// IPQuota limits requests of the tag API per client IP, zero rate disables the limit.
+	IPQuota Quota
+	// TokenQuota limits requests per token (or client certificate identity) without own quota in TokenQuotas.
+	TokenQuota  Quota
+	TokenQuotas map[string]Quota
+	// TrustForwardedFor takes client IP from X-Forwarded-For, set it only behind a proxy which overwrites it.
+	TrustForwardedFor bool
+	// Search sets how many workers shared by all requests search for tags, how many tasks wait for them
+	// and from how many children they search in parallel.
+	Search repository.SearchConfig
+	// MaxConcurrentSearches caps tag searches running at the same time, zero means unlimited.
+	MaxConcurrentSearches int
+	// TraceExporter is where spans of requests go: "stdout", "otlp" or empty for no tracing.
+	TraceExporter string
+	// OTLPEndpoint is the base URL of the OpenTelemetry collector used by the otlp exporter.
+	OTLPEndpoint string
+	// ServiceName identifies this service in traces.
+	ServiceName string
+}
+
+// DefaultConfig returns the configuration used when nothing else is specified.
+func DefaultConfig() Config {
+	return Config{
+		ReloadInterval: 2 * time.Second,
+		// HINT: docker stop kills the container 10 seconds after SIGTERM
+		DrainTimeout:          8 * time.Second,
+		Host:                  "localhost",
+		Port:                  8080,
+		IPQuota:               Quota{Rate: 50, Burst: 100},
+		TokenQuota:            Quota{Rate: 20, Burst: 40},
+		Search:                repository.DefaultSearchConfig(),
+		MaxConcurrentSearches: 64,
+		OTLPEndpoint:          "http://localhost:4318",
+		ServiceName:           "tags",
+	}
+}
+
+// ConfigFromEnv overrides the given config with TAGS_* environment variables which are set.
+func ConfigFromEnv(config Config) (Config, error) {
+	if value, ok := os.LookupEnv("TAGS_FILE"); ok {
+		config.TagsFile = value
+	}
+	if value, ok := os.LookupEnv("TAGS_RELOAD_INTERVAL"); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_RELOAD_INTERVAL: %w", err)
+		}
+		config.ReloadInterval = interval
+	}
+	if value, ok := os.LookupEnv("TAGS_SHUTDOWN_DELAY"); ok {
+		delay, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_SHUTDOWN_DELAY: %w", err)
+		}
+		config.ShutdownDelay = delay
+	}
+	if value, ok := os.LookupEnv("TAGS_DRAIN_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_DRAIN_TIMEOUT: %w", err)
+		}
+		config.DrainTimeout = timeout
+	}
+	if value, ok := os.LookupEnv("TAGS_HOST"); ok {
+		config.Host = value
+	}
+	if value, ok := os.LookupEnv("TAGS_PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_PORT: %w", err)
+		}
+		config.Port = port
+	}
+	if value, ok := os.LookupEnv("TAGS_TLS_CERT"); ok {
+		config.CertFile = value
+	}
+	if value, ok := os.LookupEnv("TAGS_TLS_KEY"); ok {
+		config.KeyFile = value
+	}
+	if value, ok := os.LookupEnv("TAGS_TLS_CLIENT_CA"); ok {
+		config.ClientCAFile = value
+	}
+	if value, ok := os.LookupEnv("TAGS_TLS_REQUIRE_CLIENT_CERT"); ok {
+		require, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_TLS_REQUIRE_CLIENT_CERT: %w", err)
+		}
+		config.RequireClientCert = require
+	}
+	if value, ok := os.LookupEnv("TAGS_TLS_IDENTITIES"); ok {
+		identities, err := ParseIdentities(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_TLS_IDENTITIES: %w", err)
+		}
+		config.ClientIdentities = identities
+	}
+	if value, ok := os.LookupEnv("TAGS_IP_QUOTA"); ok {
+		quota, err := ParseQuota(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_IP_QUOTA: %w", err)
+		}
+		config.IPQuota = quota
+	}
+	if value, ok := os.LookupEnv("TAGS_TOKEN_QUOTA"); ok {
+		quota, err := ParseQuota(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_TOKEN_QUOTA: %w", err)
+		}
+		config.TokenQuota = quota
+	}
+	if value, ok := os.LookupEnv("TAGS_TOKEN_QUOTAS"); ok {
+		quotas, err := ParseQuotas(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_TOKEN_QUOTAS: %w", err)
+		}
+		config.TokenQuotas = quotas
+	}
+	if value, ok := os.LookupEnv("TAGS_TRUST_FORWARDED_FOR"); ok {
+		trust, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_TRUST_FORWARDED_FOR: %w", err)
+		}
+		config.TrustForwardedFor = trust
+	}
+	if value, ok := os.LookupEnv("TAGS_SEARCH_WORKERS"); ok {
+		workers, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_SEARCH_WORKERS: %w", err)
+		}
+		config.Search.Workers = workers
+	}
+	if value, ok := os.LookupEnv("TAGS_SEARCH_QUEUE"); ok {
+		queue, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_SEARCH_QUEUE: %w", err)
+		}
+		config.Search.QueueSize = queue
+	}
+	if value, ok := os.LookupEnv("TAGS_SEARCH_THRESHOLD"); ok {
+		threshold, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_SEARCH_THRESHOLD: %w", err)
+		}
+		config.Search.ParallelThreshold = threshold
+	}
+	if value, ok := os.LookupEnv("TAGS_MAX_CONCURRENT_SEARCHES"); ok {
+		searches, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("TAGS_MAX_CONCURRENT_SEARCHES: %w", err)
+		}
+		config.MaxConcurrentSearches = searches
+	}
+	if value, ok := os.LookupEnv("TAGS_TRACE_EXPORTER"); ok {
+		config.TraceExporter = value
+	}
+	if value, ok := os.LookupEnv("TAGS_OTLP_ENDPOINT"); ok {
+		config.OTLPEndpoint = value
+	}
+	if value, ok := os.LookupEnv("TAGS_SERVICE_NAME"); ok {
+		config.ServiceName = value
+	}
+	return config, nil
+}
+
+// ParseIdentities parses a comma separated list of subject=identity pairs,
+// e.g. "frontend.mesh.local=frontend,spiffe://mesh/backend=backend".
+func ParseIdentities(value string) (map[string]string, error) {
+	identities := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		// HINT: split on the last "=" as URI SANs can contain "=" in query, identities can not
+		separator := strings.LastIndex(pair, "=")
+		if separator <= 0 || separator == len(pair)-1 {
+			return nil, fmt.Errorf("expected subject=identity, got %q", pair)
+		}
+		identities[pair[:separator]] = pair[separator+1:]
+	}
+	return identities, nil
+}
+
+// Addr returns the address the server listens on.
+func (c Config) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// TLS reports whether the server is configured to serve HTTPS.
+func (c Config) TLS() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
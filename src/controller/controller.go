@@ -2,18 +2,49 @@ package controller
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/url"
 	"os"
+	"strings"
 
 	"github.com/landrisek/cisco/src/repository"
 )
 
-// Log logs an error message along with the provided error.
-func Log(err error, msg string) {
-	if err != nil {
-		log.Fatalf(msg+": %s", err)
+// logger is used by the whole application, replace it with SetLogger.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// NewLogger creates a leveled structured logger writing to w.
+// Format is "json" or "logfmt" (key=value pairs), level is one of debug, info, warn and error.
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var leveler slog.Level
+	if err := leveler.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: leveler}
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case "logfmt", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use json or logfmt", format)
+	}
+}
+
+// SetLogger replaces the logger used by the application.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// Log logs an error message along with the provided error, nil error is ignored.
+// It returns true when an error was logged, so the caller decides whether it can go on.
+func Log(err error, msg string) bool {
+	if err == nil {
+		return false
 	}
+	logger.Error(msg, "error", err)
+	return true
 }
 
 type testCase struct {
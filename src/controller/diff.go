@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// attributed is implemented by nodes carrying attributes, as MyNode does.
+type attributed interface {
+	GetAttributes() map[string]interface{}
+}
+
+// flatNode is a node of flatTree, nodes refer to each other by their index in preorder.
+type flatNode struct {
+	node     repository.GNode
+	parent   int
+	children []int
+}
+
+// flatTree is a tree in preorder, the root has index 0 and parent -1.
+type flatTree []flatNode
+
+// flatten lists the nodes of the tree in preorder with indexes of their parents and children.
+func flatten(root repository.GNode) flatTree {
+	var tree flatTree
+	if root == nil {
+		return tree
+	}
+	var visit func(node repository.GNode, parent int)
+	visit = func(node repository.GNode, parent int) {
+		index := len(tree)
+		tree = append(tree, flatNode{node: node, parent: parent})
+		if parent >= 0 {
+			tree[parent].children = append(tree[parent].children, index)
+		}
+		for _, child := range node.GetChildren() {
+			visit(child, index)
+		}
+	}
+	visit(root, -1)
+	return tree
+}
+
+// identity is what a node is recognized by in another version of the tree, its "id" attribute
+// when it has one and its name otherwise.
+func identity(node repository.GNode) string {
+	if attributed, ok := node.(attributed); ok {
+		if id, ok := attributed.GetAttributes()["id"].(string); ok {
+			return "id:" + id
+		}
+	}
+	return "name:" + node.GetName()
+}
+
+// parentName returns the name of the parent of the node at index, empty for the root.
+func (t flatTree) parentName(index int) string {
+	if t[index].parent < 0 {
+		return ""
+	}
+	return t[t[index].parent].node.GetName()
+}
+
+// matchTrees pairs nodes of two versions of a tree, matched[i] is the index in b of the node i of a or -1.
+// Nodes are paired by identity first, roots always. Nodes left are paired as renamed when at least half
+// of their children are paired with each other, and leaves when they are at the same position under paired parents.
+func matchTrees(a flatTree, b flatTree) []int {
+	matched := make([]int, len(a))
+	reverse := make([]int, len(b))
+	for i := range matched {
+		matched[i] = -1
+	}
+	for j := range reverse {
+		reverse[j] = -1
+	}
+	pair := func(i int, j int) {
+		matched[i], reverse[j] = j, i
+	}
+
+	// HINT: repeated identities are paired in preorder, the first with the first
+	byIdentity := make(map[string][]int)
+	for j, node := range b {
+		key := identity(node.node)
+		byIdentity[key] = append(byIdentity[key], j)
+	}
+	for i, node := range a {
+		key := identity(node.node)
+		if candidates := byIdentity[key]; len(candidates) > 0 {
+			pair(i, candidates[0])
+			byIdentity[key] = candidates[1:]
+		}
+	}
+
+	// the roots are the same tree, whatever they are called
+	if len(a) > 0 && len(b) > 0 && matched[0] < 0 && reverse[0] < 0 {
+		pair(0, 0)
+	}
+
+	// inner nodes from the bottom, so renamed parents of renamed nodes are recognized too
+	for i := len(a) - 1; i >= 0; i-- {
+		if matched[i] >= 0 || len(a[i].children) == 0 {
+			continue
+		}
+		votes := make(map[int]int)
+		for _, child := range a[i].children {
+			if j := matched[child]; j >= 0 && b[j].parent >= 0 && reverse[b[j].parent] < 0 {
+				votes[b[j].parent]++
+			}
+		}
+		best, count := -1, 0
+		for j, n := range votes {
+			if n > count || (n == count && j < best) {
+				best, count = j, n
+			}
+		}
+		if best >= 0 && 2*count >= max(len(a[i].children), len(b[best].children)) {
+			pair(i, best)
+		}
+	}
+
+	for i := range a {
+		parent := a[i].parent
+		if matched[i] >= 0 || len(a[i].children) > 0 || parent < 0 || matched[parent] < 0 {
+			continue
+		}
+		position := 0
+		for position < len(a[parent].children) && a[parent].children[position] != i {
+			position++
+		}
+		siblings := b[matched[parent]].children
+		if position < len(siblings) {
+			j := siblings[position]
+			if reverse[j] < 0 && len(b[j].children) == 0 {
+				pair(i, j)
+			}
+		}
+	}
+	return matched
+}
+
+// ChangeKind is the kind of difference between two versions of a tree.
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Renamed ChangeKind = "renamed"
+	Moved   ChangeKind = "moved"
+)
+
+// Change is one difference between two versions of a tree. A node renamed and moved at once is two changes.
+type Change struct {
+	Kind ChangeKind
+	// Name is the name in the new version, in the old one for removed nodes.
+	Name string
+	// OldName is the name in the old version of renamed nodes.
+	OldName string
+	// Parent is the name of the parent in the new version of added and moved nodes.
+	Parent string
+	// OldParent is the name of the parent in the old version of removed and moved nodes.
+	OldParent string
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s added under %s", c.Name, c.Parent)
+	case Removed:
+		return fmt.Sprintf("- %s removed from %s", c.Name, c.OldParent)
+	case Renamed:
+		return fmt.Sprintf("~ %s renamed to %s", c.OldName, c.Name)
+	}
+	return fmt.Sprintf("> %s moved from %s to %s", c.Name, c.OldParent, c.Parent)
+}
+
+// Diff returns changes turning tree a into tree b: nodes renamed, moved and added in preorder of b
+// and then nodes removed in preorder of a. Nodes are recognized by their "id" attribute or name,
+// renamed nodes without id by their children or position, see matchTrees.
+func Diff(a repository.GNode, b repository.GNode) []Change {
+	before, after := flatten(a), flatten(b)
+	matched := matchTrees(before, after)
+	reverse := make([]int, len(after))
+	for j := range reverse {
+		reverse[j] = -1
+	}
+	for i, j := range matched {
+		if j >= 0 {
+			reverse[j] = i
+		}
+	}
+
+	var changes []Change
+	for j, node := range after {
+		i := reverse[j]
+		if i < 0 {
+			changes = append(changes, Change{Kind: Added, Name: node.node.GetName(), Parent: after.parentName(j)})
+			continue
+		}
+		if old := before[i].node.GetName(); old != node.node.GetName() {
+			changes = append(changes, Change{Kind: Renamed, Name: node.node.GetName(), OldName: old})
+		}
+		parent := before[i].parent
+		if parent >= 0 && node.parent >= 0 && matched[parent] != node.parent {
+			changes = append(changes, Change{Kind: Moved, Name: node.node.GetName(), Parent: after.parentName(j), OldParent: before.parentName(i)})
+		}
+	}
+	for i, node := range before {
+		if matched[i] < 0 {
+			changes = append(changes, Change{Kind: Removed, Name: node.node.GetName(), OldParent: before.parentName(i)})
+		}
+	}
+	return changes
+}
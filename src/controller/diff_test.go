@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// parseTags converts the JSON as UploadJson does with the content of a file.
+func parseTags(t *testing.T, content string) repository.GNode {
+	var input interface{}
+	if err := json.Unmarshal([]byte(content), &input); err != nil {
+		t.Fatal(err)
+	}
+	node, err := convertNode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+const baseTags = `{"name": "animals", "children": [
+	{"name": "mammals", "children": [{"name": "dogs", "id": "d"}, {"name": "cats"}]},
+	{"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]},
+	{"name": "fish"}
+]}`
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		after    string
+		expected []string
+	}{
+		{name: "Test same", after: baseTags, expected: nil},
+		{
+			name: "Test added and removed",
+			after: `{"name": "animals", "children": [
+				{"name": "mammals", "children": [{"name": "dogs", "id": "d"}, {"name": "cats"}, {"name": "horses"}]},
+				{"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]}
+			]}`,
+			expected: []string{"+ horses added under mammals", "- fish removed from animals"},
+		},
+		{
+			name: "Test renamed by id",
+			after: `{"name": "animals", "children": [
+				{"name": "mammals", "children": [{"name": "canines", "id": "d"}, {"name": "cats"}]},
+				{"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]},
+				{"name": "fish"}
+			]}`,
+			expected: []string{"~ dogs renamed to canines"},
+		},
+		{
+			name: "Test renamed by children and position",
+			after: `{"name": "animals", "children": [
+				{"name": "mammals", "children": [{"name": "dogs", "id": "d"}, {"name": "felines"}]},
+				{"name": "aves", "children": [{"name": "eagles"}, {"name": "owls"}]},
+				{"name": "fish"}
+			]}`,
+			expected: []string{"~ cats renamed to felines", "~ birds renamed to aves"},
+		},
+		{
+			name: "Test moved",
+			after: `{"name": "animals", "children": [
+				{"name": "mammals", "children": [{"name": "cats"}]},
+				{"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]},
+				{"name": "fish", "children": [{"name": "hounds", "id": "d"}]}
+			]}`,
+			expected: []string{"~ dogs renamed to hounds", "> hounds moved from mammals to fish"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual []string
+			for _, change := range Diff(parseTags(t, baseTags), parseTags(t, tc.after)) {
+				actual = append(actual, change.String())
+			}
+			if strings.Join(actual, "\n") != strings.Join(tc.expected, "\n") {
+				t.Errorf("Expected changes\n%s\nbut got\n%s", strings.Join(tc.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
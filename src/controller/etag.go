@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// cacheControl lets browsers and CDNs store tag responses, but they must revalidate them
+// with If-None-Match before reuse, so a reloaded tree is never served stale.
+const cacheControl = "public, max-age=0, must-revalidate"
+
+// entityTag returns a strong ETag for a response body served from the given tree version.
+// HINT: version is part of the tag, so every reload invalidates all cached responses even
+// when a particular subtree did not change. We prefer an extra 200 over a stale 304.
+func entityTag(version uint64, body []byte) string {
+	hash := sha256.Sum256(body)
+	return `"` + strconv.FormatUint(version, 10) + "-" + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// matchesETag reports whether the If-None-Match header value matches the etag.
+// As required for If-None-Match, the weak comparison is used, so W/ prefixes are ignored.
+func matchesETag(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
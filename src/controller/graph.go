@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// starts returns nodes a walk over the whole graph begins at: all roots and then, for parts of the graph
+// which are only cycles and so have no root, the first of their nodes in the order they were added.
+func starts(graph *repository.Graph) []*repository.GraphNode {
+	roots := graph.Roots()
+	reached := make(map[*repository.GraphNode]bool)
+	var reach func(node *repository.GraphNode)
+	reach = func(node *repository.GraphNode) {
+		if reached[node] {
+			return
+		}
+		reached[node] = true
+		for _, child := range node.GetChildren() {
+			reach(child.(*repository.GraphNode))
+		}
+	}
+	for _, root := range roots {
+		reach(root)
+	}
+	for _, node := range graph.Nodes() {
+		if !reached[node] {
+			roots = append(roots, node)
+			reach(node)
+		}
+	}
+	return roots
+}
+
+// WalkDirected returns every node of the graph once, in preorder from its roots. Unlike WalkGraph
+// a node shared by more parents is returned only where it is reached first and cycles are walked once.
+func WalkDirected(graph *repository.Graph) []repository.GNode {
+	nodes := []repository.GNode{}
+	visited := make(map[*repository.GraphNode]bool)
+	var visit func(node *repository.GraphNode)
+	visit = func(node *repository.GraphNode) {
+		if visited[node] {
+			return
+		}
+		visited[node] = true
+		nodes = append(nodes, node)
+		for _, child := range node.GetChildren() {
+			visit(child.(*repository.GraphNode))
+		}
+	}
+	for _, start := range starts(graph) {
+		visit(start)
+	}
+	return nodes
+}
+
+// PathsDirected returns paths from every root of the graph down to leaves, same as Paths does for a tree.
+// A path never visits a node twice: a node whose children are all already on the path ends it,
+// so cycles are followed once around.
+func PathsDirected(graph *repository.Graph) [][]repository.GNode {
+	var paths [][]repository.GNode
+	var path []repository.GNode
+	onPath := make(map[*repository.GraphNode]bool)
+	var visit func(node *repository.GraphNode)
+	visit = func(node *repository.GraphNode) {
+		path = append(path, node)
+		onPath[node] = true
+		extended := false
+		for _, child := range node.GetChildren() {
+			next := child.(*repository.GraphNode)
+			if onPath[next] {
+				continue
+			}
+			extended = true
+			visit(next)
+		}
+		if !extended {
+			paths = append(paths, append([]repository.GNode{}, path...))
+		}
+		onPath[node] = false
+		path = path[:len(path)-1]
+	}
+	for _, start := range starts(graph) {
+		visit(start)
+	}
+	return paths
+}
+
+// TopologicalSort orders nodes so every parent comes before its children (Kahn's algorithm). Among nodes
+// ready at the same time the one added first goes first, so the order is stable. A graph with a cycle
+// has no such order, the error names nodes of the cycles. It takes O(n log n + m) for n nodes and m edges.
+func TopologicalSort(graph *repository.Graph) ([]*repository.GraphNode, error) {
+	nodes := graph.Nodes()
+	position := make(map[*repository.GraphNode]int, len(nodes))
+	incoming := make([]int, len(nodes))
+	for i, node := range nodes {
+		position[node] = i
+		incoming[i] = len(node.Parents())
+	}
+	// HINT: ready holds positions of nodes without unsorted parents, the lowest one goes first
+	ready := &positionHeap{}
+	for i := range nodes {
+		if incoming[i] == 0 {
+			*ready = append(*ready, i)
+		}
+	}
+	heap.Init(ready)
+	sorted := make([]*repository.GraphNode, 0, len(nodes))
+	for ready.Len() > 0 {
+		node := nodes[heap.Pop(ready).(int)]
+		sorted = append(sorted, node)
+		for _, child := range node.GetChildren() {
+			i := position[child.(*repository.GraphNode)]
+			incoming[i]--
+			if incoming[i] == 0 {
+				heap.Push(ready, i)
+			}
+		}
+	}
+	if len(sorted) < len(nodes) {
+		var cyclic []string
+		for _, component := range StronglyConnectedComponents(graph) {
+			if len(component) > 1 || isSelfLoop(component[0]) {
+				for _, node := range component {
+					cyclic = append(cyclic, node.ID())
+				}
+			}
+		}
+		return sorted, fmt.Errorf("graph has a cycle through %s", strings.Join(cyclic, ", "))
+	}
+	return sorted, nil
+}
+
+// positionHeap is a min-heap of positions of nodes in the graph, for container/heap.
+type positionHeap []int
+
+func (h positionHeap) Len() int           { return len(h) }
+func (h positionHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h positionHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *positionHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *positionHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+func isSelfLoop(node *repository.GraphNode) bool {
+	for _, child := range node.GetChildren() {
+		if child.(*repository.GraphNode) == node {
+			return true
+		}
+	}
+	return false
+}
+
+// StronglyConnectedComponents returns groups of nodes which can all reach each other (Tarjan's algorithm).
+// A node outside any cycle is a component on its own. Components come in reverse topological order,
+// children before parents, and nodes of a component in the order they were visited.
+func StronglyConnectedComponents(graph *repository.Graph) [][]*repository.GraphNode {
+	var components [][]*repository.GraphNode
+	index := make(map[*repository.GraphNode]int)
+	low := make(map[*repository.GraphNode]int)
+	onStack := make(map[*repository.GraphNode]bool)
+	var stack []*repository.GraphNode
+	var connect func(node *repository.GraphNode)
+	connect = func(node *repository.GraphNode) {
+		index[node] = len(index)
+		low[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+		for _, child := range node.GetChildren() {
+			next := child.(*repository.GraphNode)
+			if _, ok := index[next]; !ok {
+				connect(next)
+				low[node] = min(low[node], low[next])
+			} else if onStack[next] {
+				low[node] = min(low[node], index[next])
+			}
+		}
+		if low[node] != index[node] {
+			return
+		}
+		// HINT: node is the first visited node of its component, which is everything above it on the stack
+		var component []*repository.GraphNode
+		for i := len(stack) - 1; ; i-- {
+			if stack[i] == node {
+				component = append(component, stack[i:]...)
+				for _, member := range stack[i:] {
+					onStack[member] = false
+				}
+				stack = stack[:i]
+				break
+			}
+		}
+		components = append(components, component)
+	}
+	for _, node := range graph.Nodes() {
+		if _, ok := index[node]; !ok {
+			connect(node)
+		}
+	}
+	return components
+}
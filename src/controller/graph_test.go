@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// uploadGraph writes the content into a temporary file and loads it as a graph.
+func uploadGraph(t *testing.T, content string) *repository.Graph {
+	file := filepath.Join(t.TempDir(), "graph.json")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	graph, err := UploadGraph(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph
+}
+
+// ids returns ids of graph nodes joined by commas.
+func ids(nodes []*repository.GraphNode) string {
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.ID())
+	}
+	return strings.Join(names, ",")
+}
+
+func gnodeIDs(nodes []repository.GNode) string {
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.(*repository.GraphNode).ID())
+	}
+	return strings.Join(names, ",")
+}
+
+const diamondList = `{"nodes": [
+	{"id": "a", "name": "A", "children": ["b", "c"]},
+	{"id": "b", "name": "B", "children": ["d"]},
+	{"id": "c", "name": "C", "children": ["d"]},
+	{"id": "d", "name": "D"},
+	{"id": "e", "name": "E", "children": ["d"]}
+]}`
+
+// The same diamond written as trees, d is shared by its id and referenced from the second root.
+const diamondTrees = `[
+	{"id": "a", "name": "A", "children": [
+		{"id": "b", "name": "B", "children": [{"id": "d", "name": "D"}]},
+		{"id": "c", "name": "C", "children": [{"id": "d"}]}
+	]},
+	{"id": "e", "name": "E", "children": [{"id": "d"}]}
+]`
+
+func TestUploadGraph(t *testing.T) {
+	for name, content := range map[string]string{"Test node list": diamondList, "Test trees": diamondTrees} {
+		t.Run(name, func(t *testing.T) {
+			graph := uploadGraph(t, content)
+			if actual := ids(graph.Roots()); actual != "a,e" {
+				t.Errorf("Expected roots a,e, but got %s", actual)
+			}
+			d, _ := graph.Node("d")
+			if actual := ids(d.Parents()); actual != "b,c,e" {
+				t.Errorf("Expected parents of d b,c,e, but got %s", actual)
+			}
+			if d.GetName() != "D" {
+				t.Errorf("Expected name D, but got %s", d.GetName())
+			}
+		})
+	}
+
+	file := filepath.Join(t.TempDir(), "graph.json")
+	for _, content := range []string{
+		`{"nodes": [{"id": "a", "children": ["x"]}]}`,
+		`{"nodes": [{"name": "A"}]}`,
+		`[{"id": "a", "name": "A", "children": [{"id": "a", "name": "B"}]}]`,
+		`[{"id": "e", "children": [{"id": "d", "name": "D"}]}, {"id": "d", "name": "X"}]`,
+		`"a"`,
+	} {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := UploadGraph(file); err == nil {
+			t.Errorf("Expected error for %s", content)
+		}
+	}
+}
+
+func TestDirectedGraph(t *testing.T) {
+	diamond := uploadGraph(t, diamondList)
+	cycle := uploadGraph(t, `{"nodes": [
+		{"id": "a", "children": ["b"]},
+		{"id": "b", "children": ["c", "d"]},
+		{"id": "c", "children": ["a"]},
+		{"id": "d"},
+		{"id": "e", "children": ["e"]}
+	]}`)
+
+	testCases := []struct {
+		name     string
+		actual   func() string
+		expected string
+	}{
+		{name: "Test walk diamond", actual: func() string { return gnodeIDs(WalkDirected(diamond)) }, expected: "a,b,d,c,e"},
+		{name: "Test walk cycle", actual: func() string { return gnodeIDs(WalkDirected(cycle)) }, expected: "a,b,c,d,e"},
+		{name: "Test paths diamond", actual: func() string {
+			var paths []string
+			for _, path := range PathsDirected(diamond) {
+				paths = append(paths, gnodeIDs(path))
+			}
+			return strings.Join(paths, " ")
+		}, expected: "a,b,d a,c,d e,d"},
+		{name: "Test paths cycle", actual: func() string {
+			var paths []string
+			for _, path := range PathsDirected(cycle) {
+				paths = append(paths, gnodeIDs(path))
+			}
+			return strings.Join(paths, " ")
+		}, expected: "a,b,c a,b,d e"},
+		{name: "Test topological sort", actual: func() string {
+			sorted, err := TopologicalSort(diamond)
+			if err != nil {
+				return err.Error()
+			}
+			return ids(sorted)
+		}, expected: "a,b,c,e,d"},
+		{name: "Test topological sort of cycle", actual: func() string {
+			_, err := TopologicalSort(cycle)
+			if err == nil {
+				return ""
+			}
+			return err.Error()
+		}, expected: "graph has a cycle through a, b, c, e"},
+		{name: "Test components", actual: func() string {
+			var components []string
+			for _, component := range StronglyConnectedComponents(cycle) {
+				components = append(components, ids(component))
+			}
+			return strings.Join(components, " ")
+		}, expected: "d a,b,c e"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.actual(); actual != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+// The chain alternates between the ends of the order nodes were added in, 0 -> n-1 -> 1 -> n-2 -> ...
+// Rescanning the order from the lowest ready node made it quadratic.
+func TestTopologicalSortZigzag(t *testing.T) {
+	const n = 200000
+	graph := repository.NewGraph()
+	for i := 0; i < n; i++ {
+		if _, err := graph.AddNode(strconv.Itoa(i), strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chain := make([]string, 0, n)
+	for low, high := 0, n-1; low <= high; low, high = low+1, high-1 {
+		chain = append(chain, strconv.Itoa(low))
+		if low != high {
+			chain = append(chain, strconv.Itoa(high))
+		}
+	}
+	for i := 1; i < len(chain); i++ {
+		if err := graph.AddEdge(chain[i-1], chain[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sorted, err := TopologicalSort(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, node := range sorted {
+		if node.ID() != chain[i] {
+			t.Fatalf("Expected %s at %d, but got %s", chain[i], i, node.ID())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// healthz reports the process is alive. It does not depend on tags, so a slow reload never restarts the container.
+func (api *apiServer) healthz(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.Write([]byte("ok\n"))
+}
+
+// readyz reports whether the server should receive traffic: the tags are loaded and indexed
+// and the server is not shutting down.
+func (api *apiServer) readyz(writer http.ResponseWriter, request *http.Request) {
+	tree := api.tags.load()
+	if !api.ready.Load() || tree == nil || tree.nodes == 0 {
+		http.Error(writer, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.Write([]byte("ready\n"))
+}
+
+// versionInfo is the body of the /version endpoint.
+type versionInfo struct {
+	Version     string    `json:"version"`
+	Revision    string    `json:"revision,omitempty"`
+	BuildTime   string    `json:"buildTime,omitempty"`
+	GoVersion   string    `json:"goVersion"`
+	TreeVersion uint64    `json:"treeVersion"`
+	Nodes       int       `json:"nodes"`
+	LoadedAt    time.Time `json:"loadedAt"`
+}
+
+// version describes the running binary and the tag tree it currently serves.
+func (api *apiServer) version(writer http.ResponseWriter, request *http.Request) {
+	info := versionInfo{Version: "(devel)"}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = build.GoVersion
+		if build.Main.Version != "" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.time":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	if tree := api.tags.load(); tree != nil {
+		info.TreeVersion, info.Nodes, info.LoadedAt = tree.version, tree.nodes, tree.loaded
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(info)
+}
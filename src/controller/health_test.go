@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	node := *repository.NewNode().SetName("root").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("child1"),
+		*repository.NewNode().SetName("child2"),
+	})
+	api, err := newAPIServer(node, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.cancel()
+
+	get := func(url string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		api.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		return recorder
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		ready          bool
+		expectedStatus int
+	}{
+		{name: "alive", url: "/healthz", ready: true, expectedStatus: http.StatusOK},
+		{name: "ready", url: "/readyz", ready: true, expectedStatus: http.StatusOK},
+		{name: "alive while shutting down", url: "/healthz", ready: false, expectedStatus: http.StatusOK},
+		{name: "not ready while shutting down", url: "/readyz", ready: false, expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			api.ready.Store(tc.ready)
+			if recorder := get(tc.url); recorder.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, but got %d", tc.expectedStatus, recorder.Code)
+			}
+		})
+	}
+
+	recorder := get("/version")
+	var info versionInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.TreeVersion != 1 || info.Nodes != 3 || info.LoadedAt.IsZero() || info.GoVersion == "" {
+		t.Errorf("Unexpected version info %+v", info)
+	}
+}
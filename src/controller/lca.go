@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// LCAIndex answers lowest common ancestor and distance queries on a tree in constant time
+// after O(n log n) preprocessing: the Euler tour of the tree is stored with a sparse table
+// of minimal depths over its ranges. Nodes are addressed by name, the first in preorder wins
+// when names repeat. The index is read only, so it is safe for concurrent queries.
+type LCAIndex struct {
+	nodes []repository.GNode
+	depth []int
+	ids   map[string]int
+	// first is the position of the first occurrence of every node in euler
+	first []int
+	euler []int
+	// sparse[k][i] is the node of minimal depth among euler[i : i+2^k]
+	sparse [][]int
+}
+
+// NewLCAIndex preprocesses the tree under root.
+func NewLCAIndex(root repository.GNode) *LCAIndex {
+	index := &LCAIndex{ids: make(map[string]int)}
+	if root == nil {
+		return index
+	}
+	index.tour(root, 0)
+
+	size := len(index.euler)
+	index.sparse = [][]int{index.euler}
+	for k := 1; 1<<k <= size; k++ {
+		previous := index.sparse[k-1]
+		level := make([]int, size-1<<k+1)
+		for i := range level {
+			level[i] = index.shallower(previous[i], previous[i+1<<(k-1)])
+		}
+		index.sparse = append(index.sparse, level)
+	}
+	return index
+}
+
+// tour numbers nodes in preorder and records the Euler tour, the node is written again after every child.
+// HINT: recursion is as deep as the tree, same as WalkGraph and Paths
+func (x *LCAIndex) tour(node repository.GNode, depth int) {
+	id := len(x.nodes)
+	x.nodes = append(x.nodes, node)
+	x.depth = append(x.depth, depth)
+	x.first = append(x.first, len(x.euler))
+	if _, ok := x.ids[node.GetName()]; !ok {
+		x.ids[node.GetName()] = id
+	}
+	x.euler = append(x.euler, id)
+	for _, child := range node.GetChildren() {
+		x.tour(child, depth+1)
+		x.euler = append(x.euler, id)
+	}
+}
+
+func (x *LCAIndex) shallower(a int, b int) int {
+	if x.depth[a] <= x.depth[b] {
+		return a
+	}
+	return b
+}
+
+// lca returns the lowest common ancestor of two node ids as the shallowest node of the tour between them.
+func (x *LCAIndex) lca(a int, b int) int {
+	left, right := x.first[a], x.first[b]
+	if left > right {
+		left, right = right, left
+	}
+	k := bits.Len(uint(right-left+1)) - 1
+	return x.shallower(x.sparse[k][left], x.sparse[k][right-1<<k+1])
+}
+
+func (x *LCAIndex) id(name string) (int, error) {
+	id, ok := x.ids[name]
+	if !ok {
+		return 0, fmt.Errorf("tag %s was not found", name)
+	}
+	return id, nil
+}
+
+// LCA returns the lowest common ancestor of one or more named nodes.
+func (x *LCAIndex) LCA(names ...string) (repository.GNode, error) {
+	ancestor, err := x.ancestor(names)
+	if err != nil {
+		return nil, err
+	}
+	return x.nodes[ancestor], nil
+}
+
+// ancestor returns id of the lowest common ancestor of the named nodes.
+func (x *LCAIndex) ancestor(names []string) (int, error) {
+	if len(names) == 0 {
+		return 0, fmt.Errorf("no tags given")
+	}
+	ancestor, err := x.id(names[0])
+	if err != nil {
+		return 0, err
+	}
+	// HINT: LCA is associative, the common ancestor of many nodes is folded pair by pair
+	for _, name := range names[1:] {
+		id, err := x.id(name)
+		if err != nil {
+			return 0, err
+		}
+		ancestor = x.lca(ancestor, id)
+	}
+	return ancestor, nil
+}
+
+// Distance returns the number of edges on the path between two named nodes.
+func (x *LCAIndex) Distance(a string, b string) (int, error) {
+	first, err := x.id(a)
+	if err != nil {
+		return 0, err
+	}
+	second, err := x.id(b)
+	if err != nil {
+		return 0, err
+	}
+	return x.depth[first] + x.depth[second] - 2*x.depth[x.lca(first, second)], nil
+}
+
+// Depth returns the number of edges between the root and the named node.
+func (x *LCAIndex) Depth(name string) (int, error) {
+	id, err := x.id(name)
+	if err != nil {
+		return 0, err
+	}
+	return x.depth[id], nil
+}
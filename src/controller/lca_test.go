@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+func TestLCAIndex(t *testing.T) {
+	index := NewLCAIndex(exampleGraph())
+	testCases := []struct {
+		name             string
+		tags             []string
+		expectedAncestor string
+		expectedError    bool
+	}{
+		{name: "Test one tag", tags: []string{"E"}, expectedAncestor: "E"},
+		{name: "Test siblings", tags: []string{"E", "F"}, expectedAncestor: "B"},
+		{name: "Test different subtrees", tags: []string{"E", "J"}, expectedAncestor: "A"},
+		{name: "Test ancestor and descendant", tags: []string{"C", "H"}, expectedAncestor: "C"},
+		{name: "Test more tags", tags: []string{"G", "H", "I"}, expectedAncestor: "C"},
+		{name: "Test unknown tag", tags: []string{"E", "X"}, expectedError: true},
+		{name: "Test no tags", tags: nil, expectedError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ancestor, err := index.LCA(tc.tags...)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Expected error %v, but got %v", tc.expectedError, err)
+			}
+			if err == nil && ancestor.GetName() != tc.expectedAncestor {
+				t.Errorf("Expected ancestor %s, but got %s", tc.expectedAncestor, ancestor.GetName())
+			}
+		})
+	}
+}
+
+// Distances of the index have to agree with lengths of paths found by walking the tree.
+func TestLCAIndexDistances(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	nodes := []*repository.MyNode{repository.NewNode().SetName("0")}
+	for i := 1; i < 300; i++ {
+		node := repository.NewNode().SetName(strconv.Itoa(i))
+		parent := nodes[random.Intn(len(nodes))]
+		parent.SetChildren(append(parent.GetChildren(), node))
+		nodes = append(nodes, node)
+	}
+	index := NewLCAIndex(nodes[0])
+	for i := 0; i < 500; i++ {
+		a, b := strconv.Itoa(random.Intn(len(nodes))), strconv.Itoa(random.Intn(len(nodes)))
+		path, err := PathBetween(nodes[0], a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		distance, err := index.Distance(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if distance != len(path)-1 {
+			t.Fatalf("Expected distance %d between %s and %s, but got %d", len(path)-1, a, b, distance)
+		}
+	}
+}
+
+func TestRelationship(t *testing.T) {
+	server := tagServer{tags: newTagStore(exampleGraph(), "")}
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expected       relationship
+	}{
+		{
+			name:           "Test two tags",
+			query:          "tags=E,J",
+			expectedStatus: http.StatusOK,
+			expected: relationship{Tags: []string{"E", "J"}, Ancestor: "A", Depths: map[string]int{"E": 2, "J": 2},
+				Distances: []tagDistance{{From: "E", To: "J", Distance: 4}}},
+		},
+		{
+			name:           "Test three tags",
+			query:          "tags=G,C,I",
+			expectedStatus: http.StatusOK,
+			expected: relationship{Tags: []string{"G", "C", "I"}, Ancestor: "C", AncestorDepth: 1, Depths: map[string]int{"G": 2, "C": 1, "I": 2},
+				Distances: []tagDistance{{From: "G", To: "C", Distance: 1}, {From: "G", To: "I", Distance: 2}, {From: "C", To: "I", Distance: 1}}},
+		},
+		{name: "Test one tag", query: "tags=E", expectedStatus: http.StatusBadRequest},
+		{name: "Test unknown tag", query: "tags=E,X", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/relationship?token="+repository.GetValidToken()+"&"+tc.query, nil)
+			recorder := httptest.NewRecorder()
+			server.relationship(recorder, request)
+			if recorder.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, but got %d", tc.expectedStatus, recorder.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			var actual relationship
+			if err := json.Unmarshal(recorder.Body.Bytes(), &actual); err != nil {
+				t.Fatal(err)
+			}
+			expected, _ := json.Marshal(tc.expected)
+			body, _ := json.Marshal(actual)
+			if string(body) != string(expected) {
+				t.Errorf("Expected %s, but got %s", expected, body)
+			}
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/relationship?tags=E,J", nil)
+	recorder := httptest.NewRecorder()
+	server.relationship(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, but got %d", recorder.Code)
+	}
+}
+
+func BenchmarkLCAIndex(b *testing.B) {
+	tree := generateTree(10, 5, true)
+	index := NewLCAIndex(tree)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index.Distance(strconv.Itoa(i%111111), strconv.Itoa((i*7919)%111111))
+	}
+}
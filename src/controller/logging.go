@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader carries the request ID from the client or proxy and back in the response.
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request the ctx belongs to, or empty string outside of a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns the application logger annotated with the request ID of the ctx.
+func requestLogger(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
+
+// newRequestID returns a random 16 characters long hexadecimal ID.
+func newRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// validRequestID accepts IDs coming from outside only when they are reasonably short and printable,
+// so nobody can inject into our logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder remembers the status code and the size of the body written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(body []byte) (int, error) {
+	written, err := r.ResponseWriter.Write(body)
+	r.bytes += written
+	return written, err
+}
+
+// accessLog assigns every request an ID and logs it once it is served with its status, size and latency.
+// HINT: only path is logged, query carries the token.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		writer.Header().Set(requestIDHeader, id)
+		request = request.WithContext(context.WithValue(request.Context(), requestIDKey{}, id))
+
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		begin := time.Now()
+		next.ServeHTTP(recorder, request)
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.Log(request.Context(), level, "Request served",
+			"request_id", id,
+			"method", request.Method,
+			"path", request.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"latency", time.Since(begin),
+			"remote", request.RemoteAddr,
+			"user_agent", request.UserAgent())
+	})
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var output bytes.Buffer
+	jsonLogger, err := NewLogger(&output, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := logger
+	SetLogger(jsonLogger)
+	defer SetLogger(previous)
+
+	var seenID string
+	handler := accessLog(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		seenID = RequestID(request.Context())
+		http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+	}))
+
+	tests := []struct {
+		name       string
+		requestID  string
+		expectedID string
+	}{
+		{name: "generated request id", requestID: ""},
+		{name: "propagated request id", requestID: "abc-123", expectedID: "abc-123"},
+		{name: "invalid request id is replaced", requestID: "with space"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			output.Reset()
+			request := httptest.NewRequest(http.MethodGet, "/taggedContent?tag=dogs&token=secret", nil)
+			if tc.requestID != "" {
+				request.Header.Set(requestIDHeader, tc.requestID)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+				t.Fatalf("Expected one JSON log line, but got %q", output.String())
+			}
+			id := recorder.Header().Get(requestIDHeader)
+			if id == "" || id != seenID || entry["request_id"] != id {
+				t.Errorf("Expected the same request id in response %q, context %q and log %v", id, seenID, entry["request_id"])
+			}
+			if tc.expectedID != "" && id != tc.expectedID {
+				t.Errorf("Expected request id %q, but got %q", tc.expectedID, id)
+			}
+			if tc.requestID != "" && tc.expectedID == "" && id == tc.requestID {
+				t.Errorf("Expected invalid request id %q to be replaced", tc.requestID)
+			}
+			if entry["status"] != float64(http.StatusUnauthorized) || entry["path"] != "/taggedContent" || entry["latency"] == nil {
+				t.Errorf("Unexpected access log entry %v", entry)
+			}
+			if strings.Contains(output.String(), "secret") {
+				t.Errorf("Expected token not to be logged, but got %q", output.String())
+			}
+		})
+	}
+}
+
+func TestLog(t *testing.T) {
+	var output bytes.Buffer
+	textLogger, err := NewLogger(&output, "logfmt", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := logger
+	SetLogger(textLogger)
+	defer SetLogger(previous)
+
+	if Log(nil, "nothing happened") {
+		t.Errorf("Expected nil error not to be logged")
+	}
+	logger.Info("below level")
+	if !Log(errors.New("boom"), "Error uploading JSON") {
+		t.Errorf("Expected error to be logged")
+	}
+	if got := output.String(); strings.Contains(got, "below level") || !strings.Contains(got, `level=ERROR msg="Error uploading JSON" error=boom`) {
+		t.Errorf("Unexpected log output %q", got)
+	}
+
+	if _, err := NewLogger(&output, "xml", "info"); err == nil {
+		t.Errorf("Expected unknown format to fail")
+	}
+	if _, err := NewLogger(&output, "json", "loud"); err == nil {
+		t.Errorf("Expected unknown level to fail")
+	}
+}
@@ -0,0 +1,323 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// Conflict is a node changed differently in both merged versions, or changed in one and removed in the other.
+type Conflict struct {
+	Name   string
+	Reason string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("! %s: %s", c.Name, c.Reason)
+}
+
+// version is a node in one of the merged trees, parent is the key of its parent in the merge, empty for the root.
+type version struct {
+	node   repository.MyNode
+	parent string
+}
+
+// mergeNode is one node in the versions being merged, a missing version is nil. The resolved
+// name, parent and attributes are set for kept nodes.
+type mergeNode struct {
+	base, ours, theirs *version
+
+	kept       bool
+	name       string
+	parent     string
+	attributes map[string]interface{}
+}
+
+// keep takes the node as it is in the version.
+func (m *mergeNode) keep(v *version) {
+	m.kept = true
+	m.name = v.node.GetName()
+	m.parent = v.parent
+	m.attributes = v.node.GetAttributes()
+}
+
+// changed reports whether the version differs from base in anything the merge looks at.
+func (m *mergeNode) changed(v *version) bool {
+	return v.node.GetName() != m.base.node.GetName() || v.parent != m.base.parent ||
+		!reflect.DeepEqual(v.node.GetAttributes(), m.base.node.GetAttributes())
+}
+
+// source is the node the merged one is copied from, so it keeps also what the merge does not look at, e.g. weight.
+func (m *mergeNode) source() repository.MyNode {
+	if m.ours != nil {
+		return m.ours.node
+	}
+	if m.theirs != nil {
+		return m.theirs.node
+	}
+	return m.base.node
+}
+
+// merger resolves nodes of three versions of a tree, nodes are kept in order of the first version they appear in.
+type merger struct {
+	nodes     map[string]*mergeNode
+	order     []string
+	conflicts []Conflict
+}
+
+func (g *merger) node(key string) *mergeNode {
+	m, ok := g.nodes[key]
+	if !ok {
+		m = &mergeNode{}
+		g.nodes[key] = m
+		g.order = append(g.order, key)
+	}
+	return m
+}
+
+func (g *merger) conflict(name string, format string, args ...interface{}) {
+	g.conflicts = append(g.conflicts, Conflict{Name: name, Reason: fmt.Sprintf(format, args...)})
+}
+
+// add registers nodes of a tree under the keys of base nodes they are paired with, other nodes get
+// keys of their identity, so a node added in both versions is merged as one.
+func (g *merger) add(tree flatTree, keyOf func(i int) string, assign func(m *mergeNode, v *version)) []string {
+	keys := make([]string, len(tree))
+	used := make(map[string]bool)
+	for i, n := range tree {
+		key := keyOf(i)
+		if key == "" {
+			key = "new:" + identity(n.node)
+			for k := 2; used[key]; k++ {
+				key = "new:" + identity(n.node) + "#" + strconv.Itoa(k)
+			}
+		}
+		used[key] = true
+		keys[i] = key
+		parent := ""
+		if n.parent >= 0 {
+			parent = keys[n.parent]
+		}
+		assign(g.node(key), &version{node: asMyNode(n.node), parent: parent})
+	}
+	return keys
+}
+
+// pick merges a value: a change made in one version wins, the same change made in both too,
+// different changes are a conflict and ours is kept.
+func (g *merger) pick(m *mergeNode, what string, get func(v *version) string) string {
+	ours, theirs := get(m.ours), get(m.theirs)
+	if ours == theirs {
+		return ours
+	}
+	if m.base != nil {
+		if base := get(m.base); ours == base {
+			return theirs
+		} else if theirs == base {
+			return ours
+		}
+	}
+	g.conflict(m.ours.node.GetName(), "%s changed to %q in ours and to %q in theirs, keeping ours", what, g.describe(what, ours), g.describe(what, theirs))
+	return ours
+}
+
+// mergeAttributes merges attributes key by key as pick does with values.
+func (g *merger) mergeAttributes(m *mergeNode) map[string]interface{} {
+	var base map[string]interface{}
+	if m.base != nil {
+		base = m.base.node.GetAttributes()
+	}
+	ours, theirs := m.ours.node.GetAttributes(), m.theirs.node.GetAttributes()
+	keys := make(map[string]bool)
+	for _, attributes := range []map[string]interface{}{base, ours, theirs} {
+		for key := range attributes {
+			keys[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	merged := make(map[string]interface{})
+	for _, key := range sorted {
+		baseValue, inBase := base[key]
+		oursValue, inOurs := ours[key]
+		theirsValue, inTheirs := theirs[key]
+		oursChanged := inOurs != inBase || !reflect.DeepEqual(oursValue, baseValue)
+		theirsChanged := inTheirs != inBase || !reflect.DeepEqual(theirsValue, baseValue)
+		value, present := oursValue, inOurs
+		if !oursChanged {
+			value, present = theirsValue, inTheirs
+		} else if theirsChanged && (inOurs != inTheirs || !reflect.DeepEqual(oursValue, theirsValue)) {
+			g.conflict(m.ours.node.GetName(), "attribute %s changed to %v in ours and to %v in theirs, keeping ours", key, oursValue, theirsValue)
+		}
+		if present {
+			merged[key] = value
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// resolve decides whether the node is kept and how it looks like in the merge.
+func (g *merger) resolve(m *mergeNode) {
+	switch {
+	case m.ours != nil && m.theirs != nil:
+		m.kept = true
+		m.name = g.pick(m, "name", func(v *version) string { return v.node.GetName() })
+		m.parent = g.pick(m, "parent", func(v *version) string { return v.parent })
+		m.attributes = g.mergeAttributes(m)
+	case m.base == nil && m.ours != nil:
+		m.keep(m.ours)
+	case m.base == nil && m.theirs != nil:
+		m.keep(m.theirs)
+	case m.ours != nil:
+		if m.changed(m.ours) {
+			g.conflict(m.ours.node.GetName(), "changed in ours but removed in theirs, keeping ours")
+			m.keep(m.ours)
+		}
+	case m.theirs != nil:
+		if m.changed(m.theirs) {
+			g.conflict(m.theirs.node.GetName(), "changed in theirs but removed in ours, keeping theirs")
+			m.keep(m.theirs)
+		}
+	}
+}
+
+// describe returns what the conflict message says about the value, names instead of keys of parents.
+func (g *merger) describe(what string, value string) string {
+	if what == "parent" && value != "" {
+		return g.nodes[value].source().GetName()
+	}
+	return value
+}
+
+// repair keeps parents of kept nodes and breaks cycles made by moves of both versions,
+// until every kept node hangs under a kept parent again.
+func (g *merger) repair() {
+	for repaired := true; repaired; {
+		repaired = false
+		for _, key := range g.order {
+			m := g.nodes[key]
+			if !m.kept || m.parent == "" {
+				continue
+			}
+			if parent := g.nodes[m.parent]; !parent.kept {
+				// HINT: nodes added in a version are always kept, so a removed parent is in base
+				g.conflict(parent.base.node.GetName(), "removed, but %s was added or moved under it, keeping it", m.name)
+				parent.keep(parent.base)
+				repaired = true
+			}
+		}
+		for _, key := range g.order {
+			if g.nodes[key].kept && g.breakCycle(key) {
+				repaired = true
+			}
+		}
+	}
+}
+
+// breakCycle moves a node of a cycle going through key back under its parent in base.
+func (g *merger) breakCycle(key string) bool {
+	seen := make(map[string]bool)
+	k := key
+	for ; k != "" && !seen[k]; k = g.nodes[k].parent {
+		seen[k] = true
+	}
+	if k == "" {
+		return false
+	}
+	// k is on the cycle, the tree of base has none, so some node of the cycle was moved
+	for start := k; ; {
+		m := g.nodes[k]
+		if m.base != nil && m.parent != m.base.parent {
+			g.conflict(m.name, "moved under its own descendant by merging both versions, keeping it under %s", g.nodes[m.base.parent].source().GetName())
+			m.parent = m.base.parent
+			return true
+		}
+		if k = m.parent; k == start {
+			return false
+		}
+	}
+}
+
+// asMyNode returns the node as MyNode, other implementations of GNode are copied by name.
+func asMyNode(node repository.GNode) repository.MyNode {
+	if myNode, ok := node.(repository.MyNode); ok {
+		return myNode
+	}
+	return *repository.NewNode().SetName(node.GetName())
+}
+
+// Merge merges changes made in ours and theirs since their common base, as git does with files.
+// Nodes are paired between versions as by Diff. A change made in one version is taken, the same
+// change made in both too. Changes of a name, parent or attribute made differently in both versions,
+// changes of a node removed in the other version and moves making a cycle are conflicts; they are
+// resolved (mostly keeping ours) and returned, so the merged tree is always complete.
+// Children are ordered as in ours, children coming from theirs only follow.
+func Merge(base repository.GNode, ours repository.GNode, theirs repository.GNode) (repository.MyNode, []Conflict, error) {
+	baseTree, oursTree, theirsTree := flatten(base), flatten(ours), flatten(theirs)
+	if len(baseTree) == 0 || len(oursTree) == 0 || len(theirsTree) == 0 {
+		return repository.MyNode{}, nil, fmt.Errorf("merged trees can not be empty")
+	}
+	g := &merger{nodes: make(map[string]*mergeNode)}
+	baseKeys := g.add(baseTree, func(i int) string { return "base:" + strconv.Itoa(i) }, func(m *mergeNode, v *version) { m.base = v })
+	pairedKey := func(tree flatTree) func(i int) string {
+		paired := make([]string, len(tree))
+		for i, j := range matchTrees(baseTree, tree) {
+			if j >= 0 {
+				paired[j] = baseKeys[i]
+			}
+		}
+		return func(j int) string { return paired[j] }
+	}
+	oursKeys := g.add(oursTree, pairedKey(oursTree), func(m *mergeNode, v *version) { m.ours = v })
+	theirsKeys := g.add(theirsTree, pairedKey(theirsTree), func(m *mergeNode, v *version) { m.theirs = v })
+
+	for _, key := range g.order {
+		g.resolve(g.nodes[key])
+	}
+	g.repair()
+
+	children := make(map[string][]string)
+	placed := make(map[string]bool)
+	var root string
+	for _, keys := range [][]string{oursKeys, theirsKeys, baseKeys} {
+		for _, key := range keys {
+			m := g.nodes[key]
+			if !m.kept || placed[key] {
+				continue
+			}
+			placed[key] = true
+			if m.parent == "" {
+				if root != "" {
+					return repository.MyNode{}, g.conflicts, fmt.Errorf("merged tree has more roots, %s and %s", g.nodes[root].name, m.name)
+				}
+				root = key
+				continue
+			}
+			children[m.parent] = append(children[m.parent], key)
+		}
+	}
+	if root == "" {
+		return repository.MyNode{}, g.conflicts, fmt.Errorf("merged tree has no root")
+	}
+
+	var build func(key string) repository.MyNode
+	build = func(key string) repository.MyNode {
+		m := g.nodes[key]
+		var nodes []repository.GNode
+		for _, child := range children[key] {
+			nodes = append(nodes, build(child))
+		}
+		return m.source().WithName(m.name).WithAttributes(m.attributes).WithChildren(nodes)
+	}
+	return build(root), g.conflicts, nil
+}
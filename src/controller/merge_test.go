@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	testCases := []struct {
+		name              string
+		ours              string
+		theirs            string
+		expectedTree      string
+		expectedConflicts []string
+	}{
+		{
+			name:         "Test changes of both",
+			ours:         `{"name": "animals", "children": [{"name": "mammals", "children": [{"name": "dogs", "id": "d"}, {"name": "cats"}, {"name": "horses"}]}, {"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]}, {"name": "fish"}]}`,
+			theirs:       `{"name": "animals", "children": [{"name": "mammals", "children": [{"name": "canines", "id": "d"}, {"name": "cats"}]}, {"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]}]}`,
+			expectedTree: `{"name":"animals","children":[{"name":"mammals","children":[{"name":"canines","id":"d","children":null},{"name":"cats","children":null},{"name":"horses","children":null}]},{"name":"birds","children":[{"name":"eagles","children":null},{"name":"owls","children":null}]}]}`,
+		},
+		{
+			name:              "Test renamed differently",
+			ours:              `{"name": "animals", "children": [{"name": "mammals", "children": [{"name": "hounds", "id": "d"}, {"name": "cats"}]}, {"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]}, {"name": "fish"}]}`,
+			theirs:            `{"name": "animals", "children": [{"name": "mammals", "children": [{"name": "canines", "id": "d"}, {"name": "cats"}]}, {"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]}, {"name": "fish"}]}`,
+			expectedTree:      `{"name":"animals","children":[{"name":"mammals","children":[{"name":"hounds","id":"d","children":null},{"name":"cats","children":null}]},{"name":"birds","children":[{"name":"eagles","children":null},{"name":"owls","children":null}]},{"name":"fish","children":null}]}`,
+			expectedConflicts: []string{`! hounds: name changed to "hounds" in ours and to "canines" in theirs, keeping ours`},
+		},
+		{
+			name:              "Test added under removed",
+			ours:              `{"name": "animals", "children": [{"name": "mammals", "children": [{"name": "dogs", "id": "d"}, {"name": "cats"}]}, {"name": "fish"}]}`,
+			theirs:            `{"name": "animals", "children": [{"name": "mammals", "children": [{"name": "dogs", "id": "d"}, {"name": "cats"}]}, {"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}, {"name": "parrots"}]}, {"name": "fish"}]}`,
+			expectedTree:      `{"name":"animals","children":[{"name":"mammals","children":[{"name":"dogs","id":"d","children":null},{"name":"cats","children":null}]},{"name":"fish","children":null},{"name":"birds","children":[{"name":"parrots","children":null}]}]}`,
+			expectedConflicts: []string{"! birds: removed, but parrots was added or moved under it, keeping it"},
+		},
+		// only one of the moves can be taken, mammals goes back under animals and birds stays under mammals
+		{
+			name:              "Test moves making cycle",
+			ours:              `{"name": "animals", "children": [{"name": "birds", "children": [{"name": "mammals", "children": [{"name": "dogs", "id": "d"}, {"name": "cats"}]}, {"name": "eagles"}, {"name": "owls"}]}, {"name": "fish"}]}`,
+			theirs:            `{"name": "animals", "children": [{"name": "mammals", "children": [{"name": "dogs", "id": "d"}, {"name": "cats"}, {"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]}]}, {"name": "fish"}]}`,
+			expectedTree:      `{"name":"animals","children":[{"name":"mammals","children":[{"name":"birds","children":[{"name":"eagles","children":null},{"name":"owls","children":null}]},{"name":"dogs","id":"d","children":null},{"name":"cats","children":null}]},{"name":"fish","children":null}]}`,
+			expectedConflicts: []string{"! mammals: moved under its own descendant by merging both versions, keeping it under animals"},
+		},
+		{
+			name:              "Test attributes",
+			ours:              `{"name": "animals", "legs": 4, "children": [{"name": "mammals", "children": [{"name": "dogs", "id": "d", "sound": "woof"}, {"name": "cats"}]}, {"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]}, {"name": "fish"}]}`,
+			theirs:            `{"name": "animals", "legs": 2, "children": [{"name": "mammals", "children": [{"name": "dogs", "id": "d", "size": "big"}, {"name": "cats"}]}, {"name": "birds", "children": [{"name": "eagles"}, {"name": "owls"}]}, {"name": "fish"}]}`,
+			expectedTree:      `{"name":"animals","legs":4,"children":[{"name":"mammals","children":[{"name":"dogs","id":"d","size":"big","sound":"woof","children":null},{"name":"cats","children":null}]},{"name":"birds","children":[{"name":"eagles","children":null},{"name":"owls","children":null}]},{"name":"fish","children":null}]}`,
+			expectedConflicts: []string{"! animals: attribute legs changed to 4 in ours and to 2 in theirs, keeping ours"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, conflicts, err := Merge(parseTags(t, baseTags), parseTags(t, tc.ours), parseTags(t, tc.theirs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := merged.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tc.expectedTree {
+				t.Errorf("Expected tree\n%s\nbut got\n%s", tc.expectedTree, body)
+			}
+			var actual []string
+			for _, conflict := range conflicts {
+				actual = append(actual, conflict.String())
+			}
+			if strings.Join(actual, "\n") != strings.Join(tc.expectedConflicts, "\n") {
+				t.Errorf("Expected conflicts\n%s\nbut got\n%s", strings.Join(tc.expectedConflicts, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// HINT: Prometheus text format is simple enough to be written by hand, which spares us
+// the client library and its dependencies for a handful of metrics.
+
+// counterVec is a counter partitioned by label values.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name string, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// inc increments the counter for the given label values, in order of labels.
+func (c *counterVec) inc(values ...string) {
+	c.mutex.Lock()
+	c.values[formatLabels(c.labels, values)]++
+	c.mutex.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, labels := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatFloat(c.values[labels]))
+	}
+}
+
+// histogramVec is a histogram with cumulative buckets partitioned by label values.
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name string, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+// observe records the value for the given label values, in order of labels.
+func (h *histogramVec) observe(value float64, values ...string) {
+	key := formatLabels(h.labels, values)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, labels := range keys {
+		series := h.series[labels]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", formatFloat(bound)), series.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, series.count)
+	}
+}
+
+// gaugeFunc is a gauge whose value is read when metrics are scraped.
+type gaugeFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+func (g gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.value()))
+}
+
+// counterFunc is a counter whose value is read when metrics are scraped.
+type counterFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+func (c counterFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", c.name, c.help, c.name, c.name, formatFloat(c.value()))
+}
+
+// formatLabels renders label pairs as {name="value",...}, values are escaped as the format requires.
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+		pairs[i] = name + `="` + value + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends one more label pair to already formatted labels.
+func withLabel(labels string, name string, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serverMetrics are all metrics collected by one apiServer.
+type serverMetrics struct {
+	requests       *counterVec
+	latency        *histogramVec
+	lookups        *counterVec
+	visited        *histogramVec
+	lookupDuration *histogramVec
+	gauges         []gaugeFunc
+	counters       []counterFunc
+}
+
+func newServerMetrics(tags *tagStore, pool *repository.Pool) *serverMetrics {
+	latencyBuckets := []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	return &serverMetrics{
+		requests: newCounterVec("tags_http_requests_total", "HTTP requests by route and status code.", "route", "code"),
+		latency:  newHistogramVec("tags_http_request_duration_seconds", "HTTP request latency by route.", latencyBuckets, "route"),
+		lookups:  newCounterVec("tags_lookups_total", "Tag lookups by result, hit or miss.", "result"),
+		visited: newHistogramVec("tags_lookup_visited_nodes", "Nodes visited per tag lookup.",
+			[]float64{1, 10, 100, 1000, 10000, 100000, 1000000}),
+		lookupDuration: newHistogramVec("tags_lookup_duration_seconds", "Duration of GetSubTags.", latencyBuckets),
+		gauges: []gaugeFunc{
+			{name: "tags_pool_workers", help: "Workers of the search pool.", value: func() float64 {
+				return float64(pool.Stats().Workers)
+			}},
+			{name: "tags_pool_queued_tasks", help: "Tasks waiting in the search pool queue.", value: func() float64 {
+				return float64(pool.Stats().Queued)
+			}},
+			{name: "tags_pool_active_workers", help: "Workers of the search pool running a task.", value: func() float64 {
+				return float64(pool.Stats().Active)
+			}},
+			{name: "tags_tree_nodes", help: "Number of tags in the served tree.", value: func() float64 {
+				return float64(tags.load().nodes)
+			}},
+			{name: "tags_tree_version", help: "Version of the served tree, incremented by every reload.", value: func() float64 {
+				return float64(tags.load().version)
+			}},
+			{name: "tags_tree_loaded_timestamp_seconds", help: "Unix time the served tree was loaded.", value: func() float64 {
+				return float64(tags.load().loaded.UnixNano()) / 1e9
+			}},
+		},
+		counters: []counterFunc{
+			{name: "tags_pool_executed_tasks_total", help: "Tasks run by workers of the search pool.", value: func() float64 {
+				return float64(pool.Stats().Executed)
+			}},
+			{name: "tags_pool_inline_tasks_total", help: "Tasks run by the caller as the search pool queue was full.", value: func() float64 {
+				return float64(pool.Stats().Inline)
+			}},
+			{name: "tags_pool_panics_total", help: "Panics recovered in tasks of the search pool.", value: func() float64 {
+				return float64(pool.Stats().Panics)
+			}},
+		},
+	}
+}
+
+// observeLookup records the outcome of one GetSubTags call.
+func (m *serverMetrics) observeLookup(found bool, visited int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	if found {
+		m.lookups.inc("hit")
+	} else {
+		m.lookups.inc("miss")
+	}
+	m.visited.observe(float64(visited))
+	m.lookupDuration.observe(duration.Seconds())
+}
+
+// ServeHTTP exposes the metrics in Prometheus text format.
+func (m *serverMetrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.requests.write(writer)
+	m.latency.write(writer)
+	m.lookups.write(writer)
+	m.visited.write(writer)
+	m.lookupDuration.write(writer)
+	for _, gauge := range m.gauges {
+		gauge.write(writer)
+	}
+	for _, counter := range m.counters {
+		counter.write(writer)
+	}
+}
+
+// instrument counts requests and measures their latency per route of the mux.
+func (m *serverMetrics) instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// HINT: route is the registered pattern, not the path, to keep the number of series bounded
+		_, route := mux.Handler(request)
+		if route == "" {
+			route = "other"
+		}
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		begin := time.Now()
+		mux.ServeHTTP(recorder, request)
+		m.latency.observe(time.Since(begin).Seconds(), route)
+		m.requests.inc(route, strconv.Itoa(recorder.status))
+	})
+}
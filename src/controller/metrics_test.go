@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+func TestMetrics(t *testing.T) {
+	node := *repository.NewNode().SetName("root").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("child1"),
+		*repository.NewNode().SetName("child2"),
+	})
+	api, err := newAPIServer(node, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.cancel()
+
+	token := repository.GetValidToken()
+	for _, url := range []string{
+		"/taggedContent?tag=child2&token=" + token,
+		"/taggedContent?tag=unknown&token=" + token,
+		"/taggedContent?tag=child1&token=invalid",
+		"/healthz",
+		"/nothing/here",
+	} {
+		api.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+
+	recorder := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+
+	expected := []string{
+		`tags_http_requests_total{route="/taggedContent",code="200"} 1`,
+		`tags_http_requests_total{route="/taggedContent",code="400"} 1`,
+		`tags_http_requests_total{route="/taggedContent",code="401"} 1`,
+		`tags_http_requests_total{route="/healthz",code="200"} 1`,
+		`tags_http_requests_total{route="other",code="404"} 1`,
+		`tags_http_request_duration_seconds_count{route="/taggedContent"} 3`,
+		`tags_http_request_duration_seconds_bucket{route="/healthz",le="+Inf"} 1`,
+		`tags_lookups_total{result="hit"} 1`,
+		`tags_lookups_total{result="miss"} 1`,
+		// all three nodes are visited for the hit of the last child and for the miss
+		`tags_lookup_visited_nodes_sum 6`,
+		`tags_lookup_duration_seconds_count 2`,
+		"# TYPE tags_pool_queued_tasks gauge",
+		"# TYPE tags_pool_active_workers gauge",
+		"# TYPE tags_pool_inline_tasks_total counter",
+		"tags_tree_nodes 3",
+		"tags_tree_version 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q, but got:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// representation is one of the formats the subtree of a tag can be served in.
+type representation struct {
+	contentType string
+	encode      func(node repository.GNode) ([]byte, error)
+}
+
+// representations lists supported media types in order of preference, the first one is the default.
+var representations = []representation{
+	{contentType: "application/json", encode: encodeJSON},
+	{contentType: "application/x-ndjson", encode: encodeNDJSON},
+	{contentType: "text/csv", encode: encodeCSV},
+	{contentType: "application/xml", encode: encodeXML},
+}
+
+// mediaAliases maps other media types clients commonly send onto the supported ones.
+var mediaAliases = map[string]string{
+	"application/ndjson":    "application/x-ndjson",
+	"application/jsonl":     "application/x-ndjson",
+	"application/jsonlines": "application/x-ndjson",
+	"text/xml":              "application/xml",
+}
+
+// contentCodings lists supported compressions in order of preference.
+var contentCodings = []string{"gzip", "deflate"}
+
+// weighted is a value of an Accept-like header with its quality.
+type weighted struct {
+	value   string
+	quality float64
+}
+
+// parseWeighted parses headers like "text/csv;q=0.8, application/json" into values sorted by quality.
+// Values with the same quality keep the order in which the client sent them.
+func parseWeighted(header string) []weighted {
+	var values []weighted
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		values = append(values, weighted{value: value, quality: quality})
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].quality > values[j].quality
+	})
+	return values
+}
+
+// refused returns values the client explicitly does not accept (q=0), a wildcard must not pick them.
+func refused(values []weighted, canonical func(value string) string) map[string]bool {
+	refused := make(map[string]bool)
+	for _, value := range values {
+		if value.quality <= 0 {
+			refused[canonical(value.value)] = true
+		}
+	}
+	return refused
+}
+
+// canonicalMediaType returns the supported media type for its alias.
+func canonicalMediaType(mediaType string) string {
+	if alias, ok := mediaAliases[mediaType]; ok {
+		return alias
+	}
+	return mediaType
+}
+
+// negotiateRepresentation picks the representation for the Accept header.
+// Missing header means JSON, false is returned when nothing acceptable is supported.
+func negotiateRepresentation(accept string) (representation, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return representations[0], true
+	}
+	candidates := parseWeighted(accept)
+	excluded := refused(candidates, canonicalMediaType)
+	for _, candidate := range candidates {
+		if candidate.quality <= 0 {
+			continue
+		}
+		mediaType := canonicalMediaType(candidate.value)
+		for _, r := range representations {
+			if mediaType == r.contentType {
+				return r, true
+			}
+			if (mediaType == "*/*" || mediaType == r.contentType[:strings.Index(r.contentType, "/")]+"/*") && !excluded[r.contentType] {
+				return r, true
+			}
+		}
+	}
+	return representation{}, false
+}
+
+// negotiateEncoding picks the content coding for the Accept-Encoding header.
+// An empty string means the response is sent uncompressed.
+func negotiateEncoding(acceptEncoding string) string {
+	candidates := parseWeighted(acceptEncoding)
+	excluded := refused(candidates, func(coding string) string { return coding })
+	for _, candidate := range candidates {
+		if candidate.quality <= 0 {
+			continue
+		}
+		for _, coding := range contentCodings {
+			if candidate.value == coding || (candidate.value == "*" && !excluded[coding]) {
+				return coding
+			}
+		}
+	}
+	return ""
+}
+
+// compress encodes the body with the given content coding.
+func compress(body []byte, coding string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch coding {
+	case "gzip":
+		writer = gzip.NewWriter(&buffer)
+	case "deflate":
+		// HINT: HTTP "deflate" is the zlib format (RFC 9110), not raw deflate
+		writer = zlib.NewWriter(&buffer)
+	default:
+		return body, nil
+	}
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func encodeJSON(node repository.GNode) ([]byte, error) {
+	// HINT: MyNode marshals itself by pointer, other nodes like Tree are served as they are
+	if myNode, ok := node.(repository.MyNode); ok {
+		return json.Marshal(&myNode)
+	}
+	return json.Marshal(node)
+}
+
+// encodeNDJSON writes one JSON object per tag in preorder, each with its depth, path from the requested tag and attributes.
+func encodeNDJSON(node repository.GNode) ([]byte, error) {
+	type line struct {
+		Name  string   `json:"name"`
+		Depth int      `json:"depth"`
+		Path  []string `json:"path"`
+		// Attributes of the tag, e.g. id, description or aliases
+		Attributes map[string]interface{} `json:"attributes,omitempty"`
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	var path []string
+	var err error
+	var visit func(n repository.GNode)
+	visit = func(n repository.GNode) {
+		path = append(path, n.GetName())
+		if err == nil {
+			var attributes map[string]interface{}
+			if attributed, ok := n.(attributed); ok {
+				attributes = attributed.GetAttributes()
+			}
+			err = encoder.Encode(line{Name: n.GetName(), Depth: len(path) - 1, Path: path, Attributes: attributes})
+		}
+		for _, child := range n.GetChildren() {
+			visit(child)
+		}
+		path = path[:len(path)-1]
+	}
+	visit(node)
+	return buffer.Bytes(), err
+}
+
+// encodeCSV writes one row per path from the requested tag to a leaf.
+func encodeCSV(node repository.GNode) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	for _, path := range Paths(node) {
+		row := make([]string, 0, len(path))
+		for _, n := range path {
+			row = append(row, n.GetName())
+		}
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// xmlTag is the XML shape of a tag, children are nested elements.
+type xmlTag struct {
+	XMLName  xml.Name `xml:"tag"`
+	Name     string   `xml:"name,attr"`
+	Children []xmlTag `xml:"tag"`
+}
+
+func toXMLTag(node repository.GNode) xmlTag {
+	tag := xmlTag{Name: node.GetName()}
+	for _, child := range node.GetChildren() {
+		tag.Children = append(tag.Children, toXMLTag(child))
+	}
+	return tag
+}
+
+func encodeXML(node repository.GNode) ([]byte, error) {
+	body, err := xml.Marshal(toXMLTag(node))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
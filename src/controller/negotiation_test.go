@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+func TestNegotiation(t *testing.T) {
+	node := *repository.NewNode().SetName("root").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("child1").SetChildren([]repository.GNode{
+			*repository.NewNode().SetName("grandchild1"),
+			*repository.NewNode().SetName("grandchild2"),
+		}),
+	})
+	server := tagServer{tags: newTagStore(node, "")}
+	url := "/taggedContent?tag=child1&token=" + repository.GetValidToken()
+
+	tests := []struct {
+		name                string
+		accept              string
+		acceptEncoding      string
+		expectedStatus      int
+		expectedContentType string
+		expectedEncoding    string
+		expectedBody        string
+	}{
+		{
+			name:                "default is json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        `{"name":"child1","children":[{"name":"grandchild1","children":null},{"name":"grandchild2","children":null}]}`,
+		},
+		{
+			name:                "ndjson",
+			accept:              "application/x-ndjson",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"name":"child1","depth":0,"path":["child1"]}
+{"name":"grandchild1","depth":1,"path":["child1","grandchild1"]}
+{"name":"grandchild2","depth":1,"path":["child1","grandchild2"]}
+`,
+		},
+		{
+			name:                "csv by quality",
+			accept:              "application/json;q=0.5, text/csv",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody:        "child1,grandchild1\nchild1,grandchild2\n",
+		},
+		{
+			name:                "xml alias",
+			accept:              "text/xml",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/xml",
+			expectedBody:        `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<tag name="child1"><tag name="grandchild1"></tag><tag name="grandchild2"></tag></tag>`,
+		},
+		{
+			name:           "not acceptable",
+			accept:         "image/png",
+			expectedStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:                "gzip",
+			acceptEncoding:      "gzip, deflate",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedEncoding:    "gzip",
+			expectedBody:        `{"name":"child1","children":[{"name":"grandchild1","children":null},{"name":"grandchild2","children":null}]}`,
+		},
+		{
+			name:                "deflate preferred by quality",
+			accept:              "text/csv",
+			acceptEncoding:      "gzip;q=0.1, deflate",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedEncoding:    "deflate",
+			expectedBody:        "child1,grandchild1\nchild1,grandchild2\n",
+		},
+		{
+			name:                "gzip refused",
+			acceptEncoding:      "gzip;q=0",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        `{"name":"child1","children":[{"name":"grandchild1","children":null},{"name":"grandchild2","children":null}]}`,
+		},
+		{
+			name:                "gzip refused but any coding accepted",
+			acceptEncoding:      "gzip;q=0, *",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedEncoding:    "deflate",
+			expectedBody:        `{"name":"child1","children":[{"name":"grandchild1","children":null},{"name":"grandchild2","children":null}]}`,
+		},
+		{
+			name:                "json refused but any type accepted",
+			accept:              "application/json;q=0, */*",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"name":"child1","depth":0,"path":["child1"]}
+{"name":"grandchild1","depth":1,"path":["child1","grandchild1"]}
+{"name":"grandchild2","depth":1,"path":["child1","grandchild2"]}
+`,
+		},
+	}
+
+	etags := make(map[string]string)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, url, nil)
+			request.Header.Set("Accept", tc.accept)
+			request.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, but got %d", tc.expectedStatus, recorder.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != tc.expectedContentType {
+				t.Errorf("Expected content type %q, but got %q", tc.expectedContentType, contentType)
+			}
+			if encoding := recorder.Header().Get("Content-Encoding"); encoding != tc.expectedEncoding {
+				t.Errorf("Expected content encoding %q, but got %q", tc.expectedEncoding, encoding)
+			}
+
+			var reader io.Reader = recorder.Body
+			switch tc.expectedEncoding {
+			case "gzip":
+				gzipReader, err := gzip.NewReader(recorder.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reader = gzipReader
+			case "deflate":
+				zlibReader, err := zlib.NewReader(recorder.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reader = zlibReader
+			}
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(body, []byte(tc.expectedBody)) {
+				t.Errorf("Expected response body %q, but got %q", tc.expectedBody, string(body))
+			}
+
+			etag := recorder.Header().Get("ETag")
+			for other, otherETag := range etags {
+				if otherETag == etag && tc.expectedContentType+tc.expectedEncoding != other {
+					t.Errorf("Expected distinct ETag for each representation, but %q repeats", etag)
+				}
+			}
+			etags[tc.expectedContentType+tc.expectedEncoding] = etag
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// tasksPerWorker is how many subtrees per worker a parallel traversal splits into at most.
+// HINT: more subtrees than workers evens out uneven trees, too many of them cost more to merge than they save
+const tasksPerWorker = 4
+
+// splitBudget returns into how many subtrees a traversal on the pool is split at most.
+func splitBudget(pool *repository.Pool) int {
+	return tasksPerWorker * pool.Stats().Workers
+}
+
+// smallerThan reports whether the subtree of node has fewer than limit nodes.
+// It stops counting at limit, so checking a huge subtree costs no more than a small one.
+func smallerThan(node repository.GNode, limit int) bool {
+	count := 0
+	var visit func(node repository.GNode) bool
+	visit = func(node repository.GNode) bool {
+		count++
+		if count >= limit {
+			return false
+		}
+		for _, child := range node.GetChildren() {
+			if !visit(child) {
+				return false
+			}
+		}
+		return true
+	}
+	return visit(node)
+}
@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/landrisek/cisco/src/repository"
 )
 
@@ -33,3 +36,157 @@ func findBottom(node repository.GNode, path *[]repository.GNode, paths *[][]repo
 	// HINT: as path [A,B] was added, but next call will be on C, we need path looks like [A] where we add C so it will be [A,C]
 	*path = (*path)[:len(*path)-1]
 }
+
+// PathsParallel returns the same paths in the same order as Paths, subtrees are searched on the pool.
+// Subtrees with fewer than threshold nodes are searched sequentially, as splitting them would cost more than it saves.
+func PathsParallel(ctx context.Context, node repository.GNode, pool *repository.Pool, threshold int) ([][]repository.GNode, error) {
+	var paths [][]repository.GNode
+	if nil == node {
+		return paths, nil
+	}
+	chunks, err := pathChunks(ctx, node, nil, pool, threshold, splitBudget(pool))
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, chunk := range chunks {
+		size += len(chunk)
+	}
+	paths = make([][]repository.GNode, 0, size)
+	for _, chunk := range chunks {
+		paths = append(paths, chunk...)
+	}
+	return paths, nil
+}
+
+// pathChunks returns paths from the root through prefix and node down to leaves as consecutive chunks.
+// The budget of subtrees the search may still split into is divided among children of node.
+func pathChunks(ctx context.Context, node repository.GNode, prefix []repository.GNode, pool *repository.Pool, threshold int, budget int) ([][][]repository.GNode, error) {
+	children := node.GetChildren()
+	if budget < 2 || len(children) == 0 || smallerThan(node, threshold) {
+		var paths [][]repository.GNode
+		// HINT: every task gets its own copy of the prefix, findBottom appends to it
+		path := append([]repository.GNode{}, prefix...)
+		findBottom(node, &path, &paths)
+		return [][][]repository.GNode{paths}, nil
+	}
+	childBudget := budget / len(children)
+	if childBudget < 1 {
+		childBudget = 1
+	}
+	path := append(append([]repository.GNode{}, prefix...), node)
+	results, err := repository.Map(ctx, pool, children, func(ctx context.Context, child repository.GNode) ([][][]repository.GNode, error) {
+		return pathChunks(ctx, child, path, pool, threshold, childBudget)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var chunks [][][]repository.GNode
+	for _, result := range results {
+		chunks = append(chunks, result...)
+	}
+	return chunks, nil
+}
+
+// PathBetween returns the path from the node named from to the node named to, going up from the first
+// to their lowest common ancestor and down to the second one. First nodes in preorder with the names are taken.
+func PathBetween(root repository.GNode, from string, to string) ([]repository.GNode, error) {
+	fromPath, fromIndexes := pathTo(root, from)
+	if fromPath == nil {
+		return nil, fmt.Errorf("node %s not found", from)
+	}
+	toPath, toIndexes := pathTo(root, to)
+	if toPath == nil {
+		return nil, fmt.Errorf("node %s not found", to)
+	}
+	// HINT: nodes can not be compared (MyNode holds a slice), indexes of children on the way from the root can.
+	// Both paths share the root, the lowest common ancestor is the last node they share.
+	common := 1
+	for common < len(fromPath) && common < len(toPath) && fromIndexes[common-1] == toIndexes[common-1] {
+		common++
+	}
+	path := make([]repository.GNode, 0, len(fromPath)+len(toPath)-2*common+1)
+	for i := len(fromPath) - 1; i >= common-1; i-- {
+		path = append(path, fromPath[i])
+	}
+	return append(path, toPath[common:]...), nil
+}
+
+// pathTo returns the path from the root to the first node in preorder with the name and indexes
+// of children taken on the way, nil when there is no such node.
+func pathTo(root repository.GNode, name string) ([]repository.GNode, []int) {
+	if root == nil {
+		return nil, nil
+	}
+	var path []repository.GNode
+	var indexes []int
+	var find func(node repository.GNode) bool
+	find = func(node repository.GNode) bool {
+		path = append(path, node)
+		if node.GetName() == name {
+			return true
+		}
+		for i, child := range node.GetChildren() {
+			indexes = append(indexes, i)
+			if find(child) {
+				return true
+			}
+			indexes = indexes[:len(indexes)-1]
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if !find(root) {
+		return nil, nil
+	}
+	return path, indexes
+}
+
+// PathQuery selects paths going down from a node.
+type PathQuery struct {
+	// From is the name of the node paths start in, the root when empty.
+	From string
+	// Match selects nodes paths end in, all of them when nil.
+	Match func(repository.GNode) bool
+	// MinDepth and MaxDepth bound the number of edges of a path. Paths end in leaves, or in nodes
+	// at MaxDepth when it is not zero.
+	MinDepth int
+	MaxDepth int
+}
+
+// QueryPaths returns paths selected by the query in the same order as Paths.
+func QueryPaths(root repository.GNode, query PathQuery) ([][]repository.GNode, error) {
+	var paths [][]repository.GNode
+	if root == nil {
+		return paths, nil
+	}
+	start := root
+	if query.From != "" {
+		path, _ := pathTo(root, query.From)
+		if path == nil {
+			return nil, fmt.Errorf("node %s not found", query.From)
+		}
+		start = path[len(path)-1]
+	}
+	if query.MinDepth < 0 || query.MaxDepth < 0 || (query.MaxDepth > 0 && query.MinDepth > query.MaxDepth) {
+		return nil, fmt.Errorf("invalid depth bounds %d to %d", query.MinDepth, query.MaxDepth)
+	}
+	var path []repository.GNode
+	var visit func(node repository.GNode)
+	visit = func(node repository.GNode) {
+		path = append(path, node)
+		depth := len(path) - 1
+		if len(node.GetChildren()) == 0 || (query.MaxDepth > 0 && depth == query.MaxDepth) {
+			if depth >= query.MinDepth && (query.Match == nil || query.Match(node)) {
+				paths = append(paths, append([]repository.GNode{}, path...))
+			}
+		} else {
+			for _, child := range node.GetChildren() {
+				visit(child)
+			}
+		}
+		path = path[:len(path)-1]
+	}
+	visit(start)
+	return paths, nil
+}
@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"context"
+	"fmt"
+	"runtime"
 	"testing"
 
 	"github.com/landrisek/cisco/src/repository"
@@ -69,3 +72,152 @@ func TestPaths(t *testing.T) {
 	// If test passes, old documenation is overwriten by new one keeping what actually is microservices doing
 	generateHTMLDoc(testCases, "Paths")
 }
+
+func TestPathsParallel(t *testing.T) {
+	pool := repository.NewPool(4, 8)
+	defer pool.Close()
+	trees := map[string]repository.GNode{
+		"nil":     nil,
+		"one":     repository.NewNode().SetName("A"),
+		"wide":    generateTree(50, 2, true),
+		"deep":    generateTree(2, 12, true),
+		"uneven":  repository.NewNode().SetName("root").SetChildren([]repository.GNode{generateTree(3, 7, true), repository.NewNode().SetName("leaf")}),
+		"chained": repository.NewNode().SetName("top").SetChildren([]repository.GNode{generateTree(4, 6, true)}),
+	}
+	for name, tree := range trees {
+		for _, threshold := range []int{1, 100, 1 << 30} {
+			t.Run(fmt.Sprintf("%s threshold %d", name, threshold), func(t *testing.T) {
+				expected := Paths(tree)
+				paths, err := PathsParallel(context.Background(), tree, pool, threshold)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(paths) != len(expected) {
+					t.Fatalf("Expected %d paths, but got %d", len(expected), len(paths))
+				}
+				for i := range paths {
+					if fmt.Sprint(names(paths[i])) != fmt.Sprint(names(expected[i])) {
+						t.Fatalf("Expected path %v at %d, but got %v", names(expected[i]), i, names(paths[i]))
+					}
+				}
+			})
+		}
+	}
+}
+
+func names(path []repository.GNode) []string {
+	result := make([]string, len(path))
+	for i, node := range path {
+		result[i] = node.GetName()
+	}
+	return result
+}
+
+func BenchmarkPaths(b *testing.B) {
+	tree := benchmarkTree()
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Paths(tree)
+		}
+	})
+	for _, workers := range []int{1, 2, 4, runtime.NumCPU()} {
+		pool := repository.NewPool(workers, 64*workers)
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				PathsParallel(context.Background(), tree, pool, 10000)
+			}
+		})
+		pool.Close()
+	}
+}
+
+/*
+			   A
+		/      |    \
+	   B       C     D
+	  / \     /|\    |
+	  E  F   G H I   J
+*/
+func exampleGraph() repository.GNode {
+	return *repository.NewNode().SetName("A").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("B").SetChildren([]repository.GNode{
+			*repository.NewNode().SetName("E"),
+			*repository.NewNode().SetName("F"),
+		}),
+		*repository.NewNode().SetName("C").SetChildren([]repository.GNode{
+			*repository.NewNode().SetName("G"),
+			*repository.NewNode().SetName("H"),
+			*repository.NewNode().SetName("I"),
+		}),
+		*repository.NewNode().SetName("D").SetChildren([]repository.GNode{
+			*repository.NewNode().SetName("J"),
+		}),
+	})
+}
+
+func TestPathBetween(t *testing.T) {
+	testCases := []struct {
+		name          string
+		from          string
+		to            string
+		expected      []string
+		expectedError bool
+	}{
+		{name: "Test leaves in different subtrees", from: "E", to: "J", expected: []string{"E", "B", "A", "D", "J"}},
+		{name: "Test siblings", from: "G", to: "I", expected: []string{"G", "C", "I"}},
+		{name: "Test descendant", from: "A", to: "H", expected: []string{"A", "C", "H"}},
+		{name: "Test ancestor", from: "F", to: "B", expected: []string{"F", "B"}},
+		{name: "Test same node", from: "C", to: "C", expected: []string{"C"}},
+		{name: "Test unknown node", from: "E", to: "X", expectedError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := PathBetween(exampleGraph(), tc.from, tc.to)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Expected error %v, but got %v", tc.expectedError, err)
+			}
+			if fmt.Sprint(names(path)) != fmt.Sprint(tc.expected) {
+				t.Errorf("Expected path %v, but got %v", tc.expected, names(path))
+			}
+		})
+	}
+}
+
+func TestQueryPaths(t *testing.T) {
+	testCases := []struct {
+		name          string
+		query         PathQuery
+		expected      [][]string
+		expectedError bool
+	}{
+		{name: "Test all paths", query: PathQuery{}, expected: [][]string{{"A", "B", "E"}, {"A", "B", "F"}, {"A", "C", "G"}, {"A", "C", "H"}, {"A", "C", "I"}, {"A", "D", "J"}}},
+		{name: "Test from node", query: PathQuery{From: "C"}, expected: [][]string{{"C", "G"}, {"C", "H"}, {"C", "I"}}},
+		{
+			name:     "Test matching leaves",
+			query:    PathQuery{Match: func(node repository.GNode) bool { return node.GetName() > "G" }},
+			expected: [][]string{{"A", "C", "H"}, {"A", "C", "I"}, {"A", "D", "J"}},
+		},
+		{name: "Test max depth", query: PathQuery{MaxDepth: 1}, expected: [][]string{{"A", "B"}, {"A", "C"}, {"A", "D"}}},
+		{name: "Test min depth", query: PathQuery{From: "B", MinDepth: 2}, expected: nil},
+		{name: "Test depth range", query: PathQuery{From: "A", MinDepth: 2, MaxDepth: 2}, expected: [][]string{{"A", "B", "E"}, {"A", "B", "F"}, {"A", "C", "G"}, {"A", "C", "H"}, {"A", "C", "I"}, {"A", "D", "J"}}},
+		{name: "Test unknown node", query: PathQuery{From: "X"}, expectedError: true},
+		{name: "Test invalid bounds", query: PathQuery{MinDepth: 3, MaxDepth: 2}, expectedError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths, err := QueryPaths(exampleGraph(), tc.query)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Expected error %v, but got %v", tc.expectedError, err)
+			}
+			actual := make([][]string, 0, len(paths))
+			for _, path := range paths {
+				actual = append(actual, names(path))
+			}
+			if len(actual) != len(tc.expected) || fmt.Sprint(actual) != fmt.Sprint(tc.expected) {
+				t.Errorf("Expected paths %v, but got %v", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/landrisek/cisco/src/tracing"
+)
+
+// queryResult is the answer of the query endpoint.
+type queryResult struct {
+	Query   string      `json:"query"`
+	Matches []queryNode `json:"matches"`
+}
+
+// queryNode is a tag selected by the query, path are names from the root down to the tag.
+type queryNode struct {
+	Name       string                 `json:"name"`
+	Depth      int                    `json:"depth"`
+	Path       []string               `json:"path"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// query handles /query?q=//mammals//*[leaf and name^=b] and answers tags of the tree selected by the query,
+// see Selector for its syntax. Access rules and the cap of concurrent searches are the same as for /taggedContent.
+func (server tagServer) query(writer http.ResponseWriter, request *http.Request) {
+	if !server.admit(writer, request) {
+		return
+	}
+	query := request.URL.Query().Get("q")
+	if query == "" {
+		http.Error(writer, "Missing 'q' parameter", http.StatusBadRequest)
+		return
+	}
+	selector, err := ParseSelector(query)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	release, ok := server.limits.acquireSearch(writer)
+	if !ok {
+		return
+	}
+	tree := server.tags.load()
+	_, span := tracing.Start(request.Context(), "query")
+	span.SetAttribute("query", query)
+	result := queryResult{Query: query, Matches: []queryNode{}}
+	for _, match := range selector.Select(tree.root) {
+		node := queryNode{Name: match.Node.GetName(), Depth: len(match.Path) - 1, Path: match.Path}
+		if attributed, ok := match.Node.(attributed); ok {
+			node.Attributes = attributed.GetAttributes()
+		}
+		result.Matches = append(result.Matches, node)
+	}
+	span.End()
+	release()
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		requestLogger(request.Context()).Error("Error encoding response", "query", query, "error", err)
+		http.Error(writer, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+	headers := writer.Header()
+	etag := entityTag(tree.version, body)
+	headers.Set("ETag", etag)
+	headers.Set("Cache-Control", cacheControl)
+	if matchesETag(request.Header.Get("If-None-Match"), etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	headers.Set("Content-Type", "application/json")
+	writer.Write(body)
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota is a token bucket setting: Rate requests per second on average with bursts up to Burst requests.
+// Zero Rate means unlimited.
+type Quota struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseQuotas parses a comma separated list of key=rate:burst pairs, e.g. "XXX=10:20,YYY=1:5".
+func ParseQuotas(value string) (map[string]Quota, error) {
+	quotas := make(map[string]Quota)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		separator := strings.LastIndex(pair, "=")
+		if separator <= 0 {
+			return nil, fmt.Errorf("expected key=rate:burst, got %q", pair)
+		}
+		quota, err := ParseQuota(pair[separator+1:])
+		if err != nil {
+			return nil, err
+		}
+		quotas[pair[:separator]] = quota
+	}
+	return quotas, nil
+}
+
+// ParseQuota parses rate:burst, e.g. "10:20".
+func ParseQuota(value string) (Quota, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return Quota{}, fmt.Errorf("expected rate:burst, got %q", value)
+	}
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || rate < 0 {
+		return Quota{}, fmt.Errorf("invalid rate in %q", value)
+	}
+	burst, err := strconv.Atoi(parts[1])
+	if err != nil || burst < 1 {
+		return Quota{}, fmt.Errorf("invalid burst in %q", value)
+	}
+	return Quota{Rate: rate, Burst: burst}, nil
+}
+
+func (q Quota) String() string {
+	return strconv.FormatFloat(q.Rate, 'g', -1, 64) + ":" + strconv.Itoa(q.Burst)
+}
+
+// bucket is a token bucket, it is refilled lazily when asked.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter keeps one bucket per key, e.g. per client IP.
+type limiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{buckets: make(map[string]*bucket)}
+}
+
+// allow takes one token from the bucket of the key. When it is empty, it returns false
+// and how long it takes until a token is available.
+func (l *limiter) allow(key string, quota Quota, now time.Time) (bool, time.Duration) {
+	if quota.Rate <= 0 {
+		return true, 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(quota.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(quota.Burst), b.tokens+now.Sub(b.last).Seconds()*quota.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / quota.Rate * float64(time.Second))
+}
+
+// sweep forgets buckets idle for a while, they would be full again anyway.
+// HINT: without it every client IP ever seen stays in memory
+func (l *limiter) sweep(now time.Time) {
+	const idle = 10 * time.Minute
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimits protects the tag API: per client IP and per authenticated principal request rates
+// and a cap on searches running at the same time.
+type rateLimits struct {
+	ipQuota           Quota
+	tokenQuota        Quota
+	tokenQuotas       map[string]Quota
+	trustForwardedFor bool
+	ips               *limiter
+	tokens            *limiter
+	// searches is a semaphore, nil means unlimited
+	searches chan struct{}
+}
+
+func newRateLimits(config Config) *rateLimits {
+	limits := &rateLimits{
+		ipQuota:           config.IPQuota,
+		tokenQuota:        config.TokenQuota,
+		tokenQuotas:       config.TokenQuotas,
+		trustForwardedFor: config.TrustForwardedFor,
+		ips:               newLimiter(),
+		tokens:            newLimiter(),
+	}
+	if config.MaxConcurrentSearches > 0 {
+		limits.searches = make(chan struct{}, config.MaxConcurrentSearches)
+	}
+	return limits
+}
+
+// clientIP returns the IP of the client, taken from X-Forwarded-For only when we sit behind a trusted proxy.
+// HINT: proxies append to X-Forwarded-For and the client controls what it sent, so only the rightmost entry,
+// added by our proxy, can be trusted
+func (l *rateLimits) clientIP(request *http.Request) string {
+	if l.trustForwardedFor {
+		if values := request.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if forwarded := strings.TrimSpace(entries[len(entries)-1]); forwarded != "" {
+				return forwarded
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// allowIP answers 429 and returns false when the client IP exceeded its rate.
+func (l *rateLimits) allowIP(writer http.ResponseWriter, request *http.Request) bool {
+	if l == nil {
+		return true
+	}
+	ok, wait := l.ips.allow(l.clientIP(request), l.ipQuota, time.Now())
+	if !ok {
+		tooManyRequests(writer, wait, "Too many requests from your address")
+	}
+	return ok
+}
+
+// allowPrincipal answers 429 and returns false when the authenticated token or identity exceeded its quota.
+func (l *rateLimits) allowPrincipal(writer http.ResponseWriter, principal string) bool {
+	if l == nil {
+		return true
+	}
+	quota, ok := l.tokenQuotas[principal]
+	if !ok {
+		quota = l.tokenQuota
+	}
+	ok, wait := l.tokens.allow(principal, quota, time.Now())
+	if !ok {
+		tooManyRequests(writer, wait, "Quota of your token exceeded")
+	}
+	return ok
+}
+
+// acquireSearch takes a slot for a search, answering 503 and returning false when all slots are taken.
+// The returned function releases the slot.
+func (l *rateLimits) acquireSearch(writer http.ResponseWriter) (func(), bool) {
+	if l == nil || l.searches == nil {
+		return func() {}, true
+	}
+	select {
+	case l.searches <- struct{}{}:
+		return func() { <-l.searches }, true
+	default:
+		writer.Header().Set("Retry-After", "1")
+		http.Error(writer, "Too many searches in progress", http.StatusServiceUnavailable)
+		return nil, false
+	}
+}
+
+func tooManyRequests(writer http.ResponseWriter, wait time.Duration, message string) {
+	// HINT: Retry-After is in whole seconds, round up so a client retrying on time succeeds
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(writer, message, http.StatusTooManyRequests)
+}
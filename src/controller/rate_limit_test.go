@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter()
+	quota := Quota{Rate: 2, Burst: 3}
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		after        time.Duration
+		expectedOK   bool
+		expectedWait time.Duration
+	}{
+		{name: "burst 1", expectedOK: true},
+		{name: "burst 2", expectedOK: true},
+		{name: "burst 3", expectedOK: true},
+		{name: "bucket empty", expectedOK: false, expectedWait: 500 * time.Millisecond},
+		{name: "refilled one token", after: 500 * time.Millisecond, expectedOK: true},
+		{name: "empty again", expectedOK: false, expectedWait: 500 * time.Millisecond},
+		{name: "refill is capped by burst", after: time.Hour, expectedOK: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.after)
+			ok, wait := l.allow("client", quota, now)
+			if ok != tc.expectedOK || wait != tc.expectedWait {
+				t.Errorf("Expected %v with wait %v, but got %v with wait %v", tc.expectedOK, tc.expectedWait, ok, wait)
+			}
+		})
+	}
+	if ok, _ := l.allow("other client", quota, now); !ok {
+		t.Errorf("Expected other client to have own bucket")
+	}
+	if ok, _ := l.allow("unlimited", Quota{}, now); !ok {
+		t.Errorf("Expected zero rate to be unlimited")
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	node := *repository.NewNode().SetName("root").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("child1"),
+	})
+	config := DefaultConfig()
+	config.IPQuota = Quota{Rate: 0.001, Burst: 3}
+	config.TokenQuota = Quota{Rate: 0.001, Burst: 1}
+	config.TokenQuotas = map[string]Quota{"YYY": {Rate: 0.001, Burst: 2}}
+	server := tagServer{tags: newTagStore(node, ""), limits: newRateLimits(config)}
+
+	tests := []struct {
+		name           string
+		token          string
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{name: "default token quota", token: "XXX", remoteAddr: "10.0.0.1:1000", expectedStatus: http.StatusOK},
+		{name: "default token quota exceeded", token: "XXX", remoteAddr: "10.0.0.1:1001", expectedStatus: http.StatusTooManyRequests},
+		{name: "own token quota", token: "YYY", remoteAddr: "10.0.0.1:1002", expectedStatus: http.StatusOK},
+		{name: "ip rate exceeded", token: "YYY", remoteAddr: "10.0.0.1:1003", expectedStatus: http.StatusTooManyRequests},
+		{name: "other ip", token: "YYY", remoteAddr: "10.0.0.2:1000", expectedStatus: http.StatusOK},
+		{name: "own token quota exceeded", token: "YYY", remoteAddr: "10.0.0.3:1000", expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/taggedContent?tag=child1&token="+tc.token, nil)
+			request.RemoteAddr = tc.remoteAddr
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+			if recorder.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, but got %d", tc.expectedStatus, recorder.Code)
+			}
+			if tc.expectedStatus == http.StatusTooManyRequests && recorder.Header().Get("Retry-After") == "" {
+				t.Errorf("Expected Retry-After header")
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	config := DefaultConfig()
+	config.TrustForwardedFor = true
+	trusting := newRateLimits(config)
+	tests := []struct {
+		name      string
+		limits    *rateLimits
+		forwarded []string
+		expected  string
+	}{
+		{name: "remote address", limits: newRateLimits(DefaultConfig()), forwarded: []string{"10.0.0.9"}, expected: "192.0.2.1"},
+		{name: "added by proxy", limits: trusting, forwarded: []string{"10.0.0.9"}, expected: "10.0.0.9"},
+		{name: "spoofed by client", limits: trusting, forwarded: []string{"1.2.3.4, 10.0.0.9"}, expected: "10.0.0.9"},
+		{name: "more headers", limits: trusting, forwarded: []string{"1.2.3.4", "10.0.0.9"}, expected: "10.0.0.9"},
+		{name: "empty entry", limits: trusting, forwarded: []string{"1.2.3.4,"}, expected: "192.0.2.1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/taggedContent", nil)
+			request.RemoteAddr = "192.0.2.1:1234"
+			for _, value := range tc.forwarded {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+			if ip := tc.limits.clientIP(request); ip != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, ip)
+			}
+		})
+	}
+}
+
+func TestConcurrentSearchCap(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxConcurrentSearches = 1
+	limits := newRateLimits(config)
+
+	release, ok := limits.acquireSearch(httptest.NewRecorder())
+	if !ok {
+		t.Fatal("Expected first search to get a slot")
+	}
+	recorder := httptest.NewRecorder()
+	if _, ok := limits.acquireSearch(recorder); ok || recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected second search to be rejected with 503 and Retry-After, but got %d", recorder.Code)
+	}
+	release()
+	if _, ok := limits.acquireSearch(httptest.NewRecorder()); !ok {
+		t.Errorf("Expected released slot to be available")
+	}
+}
+
+func TestSearchCapEndpoints(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxConcurrentSearches = 1
+	server := tagServer{tags: newTagStore(exampleGraph(), ""), limits: newRateLimits(config)}
+
+	tests := []struct {
+		name    string
+		target  string
+		handler http.HandlerFunc
+	}{
+		{name: "query", target: "/query?q=//C", handler: server.query},
+		{name: "relationship", target: "/relationship?tags=E,J", handler: server.relationship},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			release, ok := server.limits.acquireSearch(httptest.NewRecorder())
+			if !ok {
+				t.Fatal("Expected a free search slot")
+			}
+			recorder := httptest.NewRecorder()
+			tc.handler(recorder, httptest.NewRequest(http.MethodGet, tc.target+"&token="+repository.GetValidToken(), nil))
+			if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") == "" {
+				t.Errorf("Expected 503 with Retry-After while all slots are taken, but got %d", recorder.Code)
+			}
+			release()
+			recorder = httptest.NewRecorder()
+			tc.handler(recorder, httptest.NewRequest(http.MethodGet, tc.target+"&token="+repository.GetValidToken(), nil))
+			if recorder.Code != http.StatusOK {
+				t.Errorf("Expected status 200 after release, but got %d", recorder.Code)
+			}
+			if _, ok := server.limits.acquireSearch(httptest.NewRecorder()); !ok {
+				t.Errorf("Expected the search to release its slot")
+			}
+			<-server.limits.searches
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/landrisek/cisco/src/tracing"
+)
+
+// relationship is the answer of the relationship endpoint.
+type relationship struct {
+	Tags []string `json:"tags"`
+	// Ancestor is the lowest common ancestor of all tags.
+	Ancestor      string         `json:"ancestor"`
+	AncestorDepth int            `json:"ancestorDepth"`
+	Depths        map[string]int `json:"depths"`
+	// Distances are numbers of edges between every pair of tags.
+	Distances []tagDistance `json:"distances"`
+}
+
+type tagDistance struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Distance int    `json:"distance"`
+}
+
+// relationship handles /relationship?tags=E,J and answers how two or more tags relate in the tree:
+// their lowest common ancestor, depths and distances between them. Access rules and the cap
+// of concurrent searches are the same as for /taggedContent.
+func (server tagServer) relationship(writer http.ResponseWriter, request *http.Request) {
+	if !server.admit(writer, request) {
+		return
+	}
+	var tags []string
+	for _, tag := range strings.Split(request.URL.Query().Get("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) < 2 {
+		http.Error(writer, "Parameter 'tags' needs at least two comma separated tags", http.StatusBadRequest)
+		return
+	}
+
+	release, ok := server.limits.acquireSearch(writer)
+	if !ok {
+		return
+	}
+	tree := server.tags.load()
+	_, span := tracing.Start(request.Context(), "relationship")
+	span.SetAttribute("tags", strings.Join(tags, ","))
+	result, err := describeRelationship(tree.lcaIndex(), tags)
+	span.RecordError(err)
+	span.End()
+	release()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		requestLogger(request.Context()).Error("Error encoding response", "tags", tags, "error", err)
+		http.Error(writer, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+	headers := writer.Header()
+	etag := entityTag(tree.version, body)
+	headers.Set("ETag", etag)
+	headers.Set("Cache-Control", cacheControl)
+	if matchesETag(request.Header.Get("If-None-Match"), etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	headers.Set("Content-Type", "application/json")
+	writer.Write(body)
+}
+
+// describeRelationship queries the index for ancestor, depths and pairwise distances of tags.
+func describeRelationship(index *LCAIndex, tags []string) (relationship, error) {
+	result := relationship{Tags: tags, Depths: make(map[string]int, len(tags))}
+	for _, tag := range tags {
+		depth, err := index.Depth(tag)
+		if err != nil {
+			return result, err
+		}
+		result.Depths[tag] = depth
+	}
+	// HINT: ancestor is taken by id, its name may repeat higher in the tree
+	ancestor, err := index.ancestor(tags)
+	if err != nil {
+		return result, err
+	}
+	result.Ancestor = index.nodes[ancestor].GetName()
+	result.AncestorDepth = index.depth[ancestor]
+	for i := range tags {
+		for j := i + 1; j < len(tags); j++ {
+			distance, err := index.Distance(tags[i], tags[j])
+			if err != nil {
+				return result, err
+			}
+			result.Distances = append(result.Distances, tagDistance{From: tags[i], To: tags[j], Distance: distance})
+		}
+	}
+	return result, nil
+}
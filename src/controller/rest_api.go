@@ -2,116 +2,314 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
 	"strconv"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/landrisek/cisco/src/repository"
+	"github.com/landrisek/cisco/src/tracing"
 )
 
 type tagServer struct {
-	tags repository.GNode
-	ctx  context.Context
+	tags       *tagStore
+	identities map[string]string
+	metrics    *serverMetrics
+	limits     *rateLimits
+	searcher   *repository.Searcher
+}
+
+// apiServer bundles the HTTP server with everything living as long as the server does.
+type apiServer struct {
+	server   *http.Server
+	mux      *http.ServeMux
+	tags     *tagStore
+	metrics  *serverMetrics
+	tracer   *tracing.Tracer
+	searcher *repository.Searcher
+	// ctx is the parent of every request context, cancel stops all searches in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// ready is false once the shutdown started, so orchestrators stop sending new traffic.
+	ready atomic.Bool
 }
 
 // RestAPI starts an HTTP server that exposes a REST API for interacting with the given node in the graph.
 // It handles requests to the "/taggedContent" endpoint by serving the tagServer handler with the provided node and context.
+// Next to it "/healthz", "/readyz" and "/version" are exposed for orchestrators and "/metrics" for Prometheus.
 // The server is started in a separate goroutine and listens for incoming requests.
-// It gracefully shuts down the server and canceling the context.
+// When config.TagsFile is set, the served tags are reloaded whenever the file changes.
+// The server listens on config.Addr() and serves HTTPS when certificate and key are configured,
+// optionally authenticating clients by their certificates.
+// On SIGINT or SIGTERM it gracefully shuts down the server, see apiServer.shutdown.
+// It returns an error when the server can not be started or stops serving on its own.
+func RestAPI(node repository.GNode, config Config) error {
+	api, err := newAPIServer(node, config)
+	if err != nil {
+		return fmt.Errorf("configuring tag server: %w", err)
+	}
+	listener, err := net.Listen("tcp", config.Addr())
+	if err != nil {
+		api.cancel()
+		return fmt.Errorf("listening for tag server: %w", err)
+	}
+	logger.Info("Tag server listening", "addr", listener.Addr().String(), "tls", api.server.TLSConfig != nil)
+	failed := make(chan error, 1)
+	go func() {
+		if err := api.serve(listener); err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	// HINT: SIGTERM is what docker stop and orchestrators send, SIGINT is Ctrl+C
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	select {
+	case received := <-signals:
+		logger.Info("Signal received", "signal", received.String())
+	case err := <-failed:
+		api.cancel()
+		return fmt.Errorf("running tag server: %w", err)
+	}
+
+	api.shutdown(config.ShutdownDelay, config.DrainTimeout)
+	return nil
+}
+
+// newAPIServer creates the server with all handlers registered, it does not listen yet.
 // This function creates a context and a cancel function to control the server and goroutines.
-func RestAPI(node repository.GNode) {
-	ctx, cancel := context.WithCancel(context.Background())
-	http.Handle("/taggedContent", &tagServer{
-		tags: node,
-		ctx:  ctx,
-	})
+func newAPIServer(node repository.GNode, config Config) (*apiServer, error) {
+	tlsConfig, err := tlsConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	tracer, err := newTracer(config)
+	if err != nil {
+		return nil, err
+	}
+
+	api := &apiServer{
+		mux:    http.NewServeMux(),
+		tags:   newTagStore(node, config.TagsFile),
+		tracer: tracer,
+	}
+	api.ctx, api.cancel = context.WithCancel(context.Background())
+	go api.tags.watch(api.ctx, config.ReloadInterval)
+	// HINT: one pool for all requests, a pool per request was starting and stopping goroutines for nothing
+	api.searcher = repository.NewSearcher(config.Search)
+	api.searcher.Pool().PanicHandler = func(recovered any) {
+		logger.Error("Search task panicked", "panic", fmt.Sprint(recovered))
+	}
+	api.metrics = newServerMetrics(api.tags, api.searcher.Pool())
+	tags := &tagServer{
+		tags:       api.tags,
+		identities: config.ClientIdentities,
+		metrics:    api.metrics,
+		limits:     newRateLimits(config),
+		searcher:   api.searcher,
+	}
+	api.mux.Handle("/taggedContent", tags)
+	api.mux.HandleFunc("/relationship", tags.relationship)
+	api.mux.HandleFunc("/query", tags.query)
+	api.mux.HandleFunc("/healthz", api.healthz)
+	api.mux.HandleFunc("/readyz", api.readyz)
+	api.mux.HandleFunc("/version", api.version)
+	api.mux.Handle("/metrics", api.metrics)
 
 	// HINT: this is on discussion
 	//http.Handle("/heap", pprof.Handler("heap").ServeHTTP)
 
-	server := &http.Server{
-		Addr: "localhost:8080",
+	api.server = &http.Server{
+		Handler:   accessLog(traceRequests(api.tracer, api.mux, api.metrics.instrument(api.mux))),
+		TLSConfig: tlsConfig,
+		// HINT: request contexts derive from ours, so canceling it reaches every GetSubTags in flight
+		BaseContext: func(net.Listener) context.Context {
+			return api.ctx
+		},
 		// HINT: These are also preventing DDoS atacks
 		ReadTimeout:    60 * time.Second, // DDoS
 		WriteTimeout:   60 * time.Second, // DDoS
 		MaxHeaderBytes: 1 << 20,          // DDos
 	}
-	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			Log(err, "Error running tag server")
-		}
-	}()
-
-	// HINT: Wait for SIGINT (Ctrl+C) signal
-	sigint := make(chan os.Signal, 1)
-	signal.Notify(sigint, os.Interrupt)
-	<-sigint
+	api.ready.Store(true)
+	return api, nil
+}
 
-	log.Println("Shutting down server...")
-	if err := server.Shutdown(ctx); err != nil {
-		Log(err, "Error shutting down tag server")
+// serve accepts connections on the listener until the server is shut down.
+func (api *apiServer) serve(listener net.Listener) error {
+	if api.server.TLSConfig != nil {
+		// HINT: certificates come from TLSConfig.GetCertificate, so they can be rotated
+		return api.server.ServeTLS(listener, "", "")
 	}
+	return api.server.Serve(listener)
+}
+
+// shutdown stops the server in steps:
+//  1. readiness is flipped to not ready and keep-alives are disabled, so no new traffic is routed to us,
+//  2. after delay the listener is closed and requests in flight are given drainTimeout to finish,
+//  3. searches still running past the deadline are canceled and their connections closed,
+//  4. workers of the search pool are stopped.
+func (api *apiServer) shutdown(delay time.Duration, drainTimeout time.Duration) {
+	logger.Info("Shutting down server", "delay", delay, "drain_timeout", drainTimeout)
+	api.ready.Store(false)
+	api.server.SetKeepAlivesEnabled(false)
+	time.Sleep(delay)
 
-	cancel()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancelDrain()
+	err := api.server.Shutdown(drainCtx)
+	// HINT: canceling base context also stops reloading of tags
+	api.cancel()
+	if err != nil {
+		logger.Warn("Requests did not drain, canceling them", "drain_timeout", drainTimeout, "error", err)
+		api.server.Close()
+	}
+	api.searcher.Close()
+	if api.tracer != nil {
+		Log(api.tracer.Close(), "Error exporting remaining spans")
+	}
 }
 
 // ServeHTTP handles HTTP requests for the tagServer handler.
 // It checks the request method, headers, and parameters for valid CORS, authentication, and tag information.
-// It optimizes goroutine utilization by setting GOMAXPROCS based on the number of available CPUs.
+// Requests over the rate of the client IP or over the quota of the token get 429 Too Many Requests,
+// searches over the concurrency cap get 503 Service Unavailable, both with Retry-After.
+// The search runs with concurrency of config.Search, which is set once at startup.
 // It retrieves the subtags from the repository using GetSubTags and returns an error if not found.
-// It encodes the subtags as JSON and writes the response to the client with appropriate headers.
+// Parameters attr.<key>=<value> keep only tags with matching attributes and their ancestors.
+// It encodes the subtags in the format negotiated by Accept (JSON, NDJSON, CSV paths or XML), compresses them
+// by Accept-Encoding (gzip or deflate) and writes the response to the client with appropriate headers.
+// Every response carries an ETag of its content, a request with matching If-None-Match gets 304 Not Modified.
 func (server tagServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	headers := writer.Header()
-	headers.Set("Access-Control-Allow-Origin", "http://localhost")
-	headers.Set("Access-Control-Allow-Methods", "GET")
-	headers.Set("Access-Control-Allow-Headers", "Access-Control-Allow-Headers, Origin,Accept, X-Requested-With, Content-Type, Access-Control-Request-Method, Access-Control-Request-Headers")
-
-	if request.Method != http.MethodGet {
-		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+	if !server.admit(writer, request) {
 		return
 	}
 
 	parameters := request.URL.Query()
-	token := parameters.Get("token")
-	if !repository.IsAuthenticated(token) {
-		http.Error(writer, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	tag := parameters.Get("tag")
 	if tag == "" {
 		http.Error(writer, "Missing 'tag' parameter", http.StatusBadRequest)
 		return
 	}
+	filters, err := parseAttributeFilters(parameters)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if runtime.NumCPU() > 1 {
-		// HINT: if there are multiple CPUs, let`s be not too greedy and use less than the total available
-		runtime.GOMAXPROCS(runtime.NumCPU() / 2)
-	} else {
-		runtime.GOMAXPROCS(1)
+	format, ok := negotiateRepresentation(request.Header.Get("Accept"))
+	if !ok {
+		http.Error(writer, "Supported formats are application/json, application/x-ndjson, text/csv and application/xml", http.StatusNotAcceptable)
+		return
 	}
 
-	subtags := repository.GetSubTags(server.ctx, server.tags, tag)
+	release, ok := server.limits.acquireSearch(writer)
+	if !ok {
+		return
+	}
+	tree := server.tags.load()
+	begin := time.Now()
+	subtags, visited := server.lookupSubTags(request.Context(), tree.root, tag)
+	release()
+	server.metrics.observeLookup(subtags != nil, visited, time.Since(begin))
 
-	if subtags.GetName() == "" {
+	if subtags == nil {
 		http.Error(writer, fmt.Sprintf("Tag %s was not found", tag), http.StatusBadRequest)
 		return
 	}
+	subtags = filterByAttributes(subtags, filters)
 
-	jsonBytes, err := json.Marshal(&subtags)
+	_, encodeSpan := tracing.Start(request.Context(), "encode")
+	encodeSpan.SetAttribute("content_type", format.contentType)
+	body, err := format.encode(subtags)
+	encodeSpan.RecordError(err)
+	encodeSpan.End()
 	if err != nil {
-		http.Error(writer, "Error encoding response as JSON", http.StatusInternalServerError)
+		requestLogger(request.Context()).Error("Error encoding response", "tag", tag, "format", format.contentType, "error", err)
+		http.Error(writer, "Error encoding response", http.StatusInternalServerError)
 		return
 	}
 
-	writer.Header().Set("Content-Type", "application/json")
+	coding := negotiateEncoding(request.Header.Get("Accept-Encoding"))
+	headers.Set("Vary", "Accept, Accept-Encoding")
+	// HINT: strong etag has to differ for every representation, the body hash covers the format
+	// and compressed bytes get the coding appended
+	etag := entityTag(tree.version, body)
+	if coding != "" {
+		etag = etag[:len(etag)-1] + "-" + coding + `"`
+	}
+	headers.Set("ETag", etag)
+	headers.Set("Cache-Control", cacheControl)
+	if matchesETag(request.Header.Get("If-None-Match"), etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, err = compress(body, coding)
+	if err != nil {
+		requestLogger(request.Context()).Error("Error compressing response", "tag", tag, "coding", coding, "error", err)
+		http.Error(writer, "Error compressing response", http.StatusInternalServerError)
+		return
+	}
+	if coding != "" {
+		headers.Set("Content-Encoding", coding)
+	}
+	headers.Set("Content-Type", format.contentType)
 	// HINT: let`s help a client
-	writer.Header().Set("Content-Length", strconv.Itoa(len(jsonBytes)))
-	writer.Write(jsonBytes)
+	headers.Set("Content-Length", strconv.Itoa(len(body)))
+	writer.Write(body)
+}
+
+// admit sets CORS headers and lets through only GET requests of authenticated clients within their rates.
+// Otherwise it answers the request and returns false.
+func (server tagServer) admit(writer http.ResponseWriter, request *http.Request) bool {
+	headers := writer.Header()
+	headers.Set("Access-Control-Allow-Origin", "http://localhost")
+	headers.Set("Access-Control-Allow-Methods", "GET")
+	headers.Set("Access-Control-Allow-Headers", "Access-Control-Allow-Headers, Origin,Accept, X-Requested-With, Content-Type, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+	if request.Method != http.MethodGet {
+		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !server.limits.allowIP(writer, request) {
+		return false
+	}
+
+	_, authSpan := tracing.Start(request.Context(), "authenticate")
+	principal, authenticated := server.authenticate(request)
+	authSpan.SetAttribute("authenticated", strconv.FormatBool(authenticated))
+	authSpan.End()
+	if !authenticated {
+		http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	// HINT: quota is checked only for valid tokens, otherwise anybody could fill memory with buckets
+	return server.limits.allowPrincipal(writer, principal)
+}
+
+// lookupSubTags searches with the configured searcher, or with default settings when there is none.
+// The matching subtree of the served tree is returned as it is, nil when none matches.
+func (server tagServer) lookupSubTags(ctx context.Context, root repository.GNode, tag string) (repository.GNode, int) {
+	if server.searcher == nil {
+		return repository.FindSubTags(ctx, root, tag)
+	}
+	return server.searcher.FindSubTags(ctx, root, tag)
+}
+
+// authenticate accepts a request with a mapped client certificate or with a valid token.
+// It returns the principal the request is made by, the identity of the certificate or the token.
+func (server tagServer) authenticate(request *http.Request) (string, bool) {
+	if identity, ok := clientIdentity(request, server.identities); ok {
+		return identity, true
+	}
+	token := request.URL.Query().Get("token")
+	return token, repository.IsAuthenticated(token)
 }
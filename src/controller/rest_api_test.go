@@ -2,7 +2,9 @@ package controller
 
 import (
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -21,7 +23,7 @@ func TestRestAPI(t *testing.T) {
 		}),
 	})
 
-	go RestAPI(node)
+	go RestAPI(node, DefaultConfig())
 
 	time.Sleep(100 * time.Millisecond) // wait for server to start
 
@@ -92,3 +94,111 @@ func TestRestAPI(t *testing.T) {
 	// Wait for server to shut down
 	time.Sleep(100 * time.Millisecond)
 }
+
+func TestConditionalGet(t *testing.T) {
+	node := *repository.NewNode().SetName("root").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("child1"),
+	})
+	server := tagServer{tags: newTagStore(node, "")}
+	url := "/taggedContent?tag=child1&token=" + repository.GetValidToken()
+
+	first := httptest.NewRecorder()
+	server.ServeHTTP(first, httptest.NewRequest(http.MethodGet, url, nil))
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected status 200 with ETag, but got %d with %q", first.Code, etag)
+	}
+	if first.Header().Get("Cache-Control") != cacheControl {
+		t.Errorf("Expected Cache-Control %q, but got %q", cacheControl, first.Header().Get("Cache-Control"))
+	}
+
+	tests := []struct {
+		name           string
+		ifNoneMatch    string
+		expectedStatus int
+	}{
+		{name: "no validator", ifNoneMatch: "", expectedStatus: http.StatusOK},
+		{name: "matching etag", ifNoneMatch: etag, expectedStatus: http.StatusNotModified},
+		{name: "matching weak etag in list", ifNoneMatch: `"other", W/` + etag, expectedStatus: http.StatusNotModified},
+		{name: "any etag", ifNoneMatch: "*", expectedStatus: http.StatusNotModified},
+		{name: "stale etag", ifNoneMatch: `"0-stale"`, expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, url, nil)
+			if tc.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+			if recorder.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, but got %d", tc.expectedStatus, recorder.Code)
+			}
+			if recorder.Code == http.StatusNotModified && recorder.Body.Len() != 0 {
+				t.Errorf("Expected empty body for 304, but got %q", recorder.Body.String())
+			}
+		})
+	}
+
+	// HINT: same content served from a reloaded tree must not validate against the old etag
+	server.tags.current.Store(&tagTree{root: repository.NewTree(node), version: 2})
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, url, nil)
+	request.Header.Set("If-None-Match", etag)
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") == etag {
+		t.Errorf("Expected new ETag after reload, but got status %d with %q", recorder.Code, recorder.Header().Get("ETag"))
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name             string
+		handlerDuration  time.Duration
+		drainTimeout     time.Duration
+		expectedCanceled bool
+	}{
+		{name: "request in flight drains", handlerDuration: 50 * time.Millisecond, drainTimeout: time.Second, expectedCanceled: false},
+		{name: "request past deadline is canceled", handlerDuration: time.Minute, drainTimeout: 50 * time.Millisecond, expectedCanceled: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			api, err := newAPIServer(*repository.NewNode().SetName("root"), DefaultConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			started := make(chan struct{})
+			canceled := make(chan bool, 1)
+			api.mux.HandleFunc("/slow", func(writer http.ResponseWriter, request *http.Request) {
+				close(started)
+				select {
+				case <-time.After(tc.handlerDuration):
+					canceled <- false
+				case <-request.Context().Done():
+					canceled <- true
+				}
+			})
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go api.serve(listener)
+			go http.Get("http://" + listener.Addr().String() + "/slow")
+			<-started
+
+			begin := time.Now()
+			api.shutdown(0, tc.drainTimeout)
+			if api.ready.Load() {
+				t.Errorf("Expected server not to be ready after shutdown")
+			}
+			if elapsed := time.Since(begin); elapsed > tc.drainTimeout+time.Second {
+				t.Errorf("Expected shutdown within drain timeout %v, but it took %v", tc.drainTimeout, elapsed)
+			}
+			if result := <-canceled; result != tc.expectedCanceled {
+				t.Errorf("Expected request canceled %v, but got %v", tc.expectedCanceled, result)
+			}
+		})
+	}
+}
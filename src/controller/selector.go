@@ -0,0 +1,492 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// Selector is a parsed query selecting nodes of a tree, in syntax borrowed from XPath:
+//
+//	/animals/mammals       child steps from the root named animals
+//	//mammals//*[leaf]     leaves anywhere under any node named mammals
+//	mammals/*[name^="b"]   a selector without leading slash starts anywhere, as with //
+//	//*[@aliases="hounds" and depth>=2]
+//
+// A step is a name, "name with spaces" in quotes or * for any name, followed by predicates in brackets:
+//   - leaf and root,
+//   - name compared by = != ^= (starts with) $= (ends with) *= (contains) or ~= (regular expression),
+//   - depth and children (their number) compared by = != < <= > >=,
+//   - @key when the node has the attribute, @key compared as name or as number by < <= > >=,
+//     a dot reaches into objects (@translations.de="Hunde") and an array matches when any element does,
+//   - conditions combined by and, or, not and parentheses,
+//   - a number alone, the position (from 1) among nodes the step selected from one node.
+type Selector struct {
+	steps []selectorStep
+}
+
+type selectorStep struct {
+	// descendant selects all nodes below the context node, otherwise only its children
+	descendant bool
+	// name is empty for *
+	name       string
+	predicates []selectorPredicate
+}
+
+// selectorPredicate is a condition or, when position is set, the position of the node.
+type selectorPredicate struct {
+	position  int
+	condition func(c selectorContext) bool
+}
+
+// selectorContext is the node a condition is evaluated on.
+type selectorContext struct {
+	node  repository.GNode
+	depth int
+}
+
+// Match is a node selected by a Selector with the names of nodes from the root down to it.
+type Match struct {
+	Node repository.GNode
+	Path []string
+}
+
+// ParseSelector parses the query, see Selector for its syntax.
+func ParseSelector(query string) (*Selector, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	parser := &selectorParser{tokens: tokens}
+	selector, err := parser.selector()
+	if err != nil {
+		return nil, fmt.Errorf("query %q: %w", query, err)
+	}
+	return selector, nil
+}
+
+// selectorOperators are operators of conditions, longer ones first so the lexer takes them whole.
+var selectorOperators = []string{"!=", "^=", "$=", "*=", "~=", "<=", ">=", "//", "=", "<", ">", "/", "[", "]", "(", ")", "@", "*"}
+
+// tokenize splits the query into operators, quoted strings (kept with the leading quote) and words.
+// The query is read by runes, so names may contain any letters.
+func tokenize(query string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+		if r == '"' || r == '\'' {
+			end := strings.IndexRune(query[i+1:], r)
+			if end < 0 {
+				return nil, fmt.Errorf("query %q: string at %d is not closed", query, i)
+			}
+			tokens = append(tokens, query[i:i+1+end])
+			i += end + 2
+			continue
+		}
+		operator := ""
+		for _, candidate := range selectorOperators {
+			if strings.HasPrefix(query[i:], candidate) {
+				operator = candidate
+				break
+			}
+		}
+		if operator != "" {
+			tokens = append(tokens, operator)
+			i += len(operator)
+			continue
+		}
+		start := i
+		for i < len(query) {
+			r, size := utf8.DecodeRuneInString(query[i:])
+			if unicode.IsSpace(r) || strings.ContainsRune(`/[]()@=!^$*~<>"'`, r) {
+				break
+			}
+			i += size
+		}
+		if i == start {
+			return nil, fmt.Errorf("query %q: unexpected %q at %d", query, r, i)
+		}
+		tokens = append(tokens, query[start:i])
+	}
+	return tokens, nil
+}
+
+// isQuoted reports whether the token is a quoted string.
+func isQuoted(token string) bool {
+	return strings.HasPrefix(token, `"`) || strings.HasPrefix(token, "'")
+}
+
+// selectorParser is a recursive descent parser of tokens of a query.
+type selectorParser struct {
+	tokens   []string
+	position int
+}
+
+func (p *selectorParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *selectorParser) next() string {
+	token := p.peek()
+	p.position++
+	return token
+}
+
+func (p *selectorParser) expect(token string) error {
+	if actual := p.next(); actual != token {
+		return fmt.Errorf("expected %s, got %q", token, actual)
+	}
+	return nil
+}
+
+// value reads a word or a quoted string, quotes are removed.
+func (p *selectorParser) value() (string, error) {
+	token := p.next()
+	switch {
+	case isQuoted(token):
+		return token[1:], nil
+	case token == "" || slices.Contains(selectorOperators, token):
+		return "", fmt.Errorf("expected a value, got %q", token)
+	}
+	return token, nil
+}
+
+func (p *selectorParser) selector() (*Selector, error) {
+	selector := &Selector{}
+	descendant := true
+	switch p.peek() {
+	case "/":
+		p.next()
+		descendant = false
+	case "//":
+		p.next()
+	}
+	for {
+		step := selectorStep{descendant: descendant}
+		if p.peek() == "*" {
+			p.next()
+		} else {
+			name, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			step.name = name
+		}
+		for p.peek() == "[" {
+			p.next()
+			predicate, err := p.predicate()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			step.predicates = append(step.predicates, predicate)
+		}
+		selector.steps = append(selector.steps, step)
+
+		switch p.next() {
+		case "":
+			return selector, nil
+		case "/":
+			descendant = false
+		case "//":
+			descendant = true
+		default:
+			return nil, fmt.Errorf("unexpected %q after step %d", p.tokens[p.position-1], len(selector.steps))
+		}
+	}
+}
+
+func (p *selectorParser) predicate() (selectorPredicate, error) {
+	token := p.peek()
+	if position, err := strconv.Atoi(token); err == nil && p.position+1 < len(p.tokens) && p.tokens[p.position+1] == "]" {
+		p.next()
+		if position < 1 {
+			return selectorPredicate{}, fmt.Errorf("position %d must be at least 1", position)
+		}
+		return selectorPredicate{position: position}, nil
+	}
+	condition, err := p.or()
+	return selectorPredicate{condition: condition}, err
+}
+
+func (p *selectorParser) or() (func(c selectorContext) bool, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "or" {
+		p.next()
+		var right func(c selectorContext) bool
+		if right, err = p.and(); err == nil {
+			first := left
+			left = func(c selectorContext) bool { return first(c) || right(c) }
+		}
+	}
+	return left, err
+}
+
+func (p *selectorParser) and() (func(c selectorContext) bool, error) {
+	left, err := p.unary()
+	for err == nil && p.peek() == "and" {
+		p.next()
+		var right func(c selectorContext) bool
+		if right, err = p.unary(); err == nil {
+			first := left
+			left = func(c selectorContext) bool { return first(c) && right(c) }
+		}
+	}
+	return left, err
+}
+
+func (p *selectorParser) unary() (func(c selectorContext) bool, error) {
+	switch p.peek() {
+	case "not":
+		p.next()
+		condition, err := p.unary()
+		return func(c selectorContext) bool { return !condition(c) }, err
+	case "(":
+		p.next()
+		condition, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return condition, p.expect(")")
+	}
+	return p.condition()
+}
+
+func (p *selectorParser) condition() (func(c selectorContext) bool, error) {
+	token := p.next()
+	switch token {
+	case "leaf":
+		return func(c selectorContext) bool { return len(c.node.GetChildren()) == 0 }, nil
+	case "root":
+		return func(c selectorContext) bool { return c.depth == 0 }, nil
+	case "name":
+		return p.comparison(func(c selectorContext) []string { return []string{c.node.GetName()} }, false)
+	case "depth":
+		return p.comparison(func(c selectorContext) []string { return []string{strconv.Itoa(c.depth)} }, true)
+	case "children":
+		return p.comparison(func(c selectorContext) []string { return []string{strconv.Itoa(len(c.node.GetChildren()))} }, true)
+	case "@":
+		key, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		path := strings.Split(key, ".")
+		texts := func(c selectorContext) []string {
+			value, _ := lookupAttribute(c.node, path)
+			return attributeTexts(value)
+		}
+		if next := p.peek(); next == "]" || next == ")" || next == "and" || next == "or" {
+			return func(c selectorContext) bool {
+				_, ok := lookupAttribute(c.node, path)
+				return ok
+			}, nil
+		}
+		return p.comparison(texts, false)
+	}
+	return nil, fmt.Errorf("unknown condition %q", token)
+}
+
+// comparison reads an operator and a value and returns the condition comparing them with texts of the node.
+// Numeric operands allow only = != < <= > >=, a text matches when any of texts does.
+func (p *selectorParser) comparison(texts func(c selectorContext) []string, numeric bool) (func(c selectorContext) bool, error) {
+	operator := p.next()
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	var compare func(text string) bool
+	number, numberErr := strconv.ParseFloat(value, 64)
+	numbers := func(less func(a float64, b float64) bool) func(text string) bool {
+		return func(text string) bool {
+			parsed, err := strconv.ParseFloat(text, 64)
+			return err == nil && less(parsed, number)
+		}
+	}
+	switch operator {
+	case "=":
+		compare = func(text string) bool { return text == value }
+	case "!=":
+		compare = func(text string) bool { return text != value }
+	case "<":
+		compare = numbers(func(a float64, b float64) bool { return a < b })
+	case "<=":
+		compare = numbers(func(a float64, b float64) bool { return a <= b })
+	case ">":
+		compare = numbers(func(a float64, b float64) bool { return a > b })
+	case ">=":
+		compare = numbers(func(a float64, b float64) bool { return a >= b })
+	case "^=", "$=", "*=", "~=":
+		if numeric {
+			return nil, fmt.Errorf("operator %s compares names, not numbers", operator)
+		}
+		switch operator {
+		case "^=":
+			compare = func(text string) bool { return strings.HasPrefix(text, value) }
+		case "$=":
+			compare = func(text string) bool { return strings.HasSuffix(text, value) }
+		case "*=":
+			compare = func(text string) bool { return strings.Contains(text, value) }
+		default:
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+			compare = pattern.MatchString
+		}
+	default:
+		return nil, fmt.Errorf("expected an operator, got %q", operator)
+	}
+	if numberErr != nil && (numeric || strings.ContainsAny(operator, "<>")) {
+		return nil, fmt.Errorf("%s needs a number, got %q", operator, value)
+	}
+	return func(c selectorContext) bool {
+		for _, text := range texts(c) {
+			if compare(text) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// Select returns nodes of the tree selected by the query, each once and in preorder.
+func (s *Selector) Select(root repository.GNode) []Match {
+	tree := flatten(root)
+	depth := make([]int, len(tree))
+	for i := range tree {
+		if tree[i].parent >= 0 {
+			depth[i] = depth[tree[i].parent] + 1
+		}
+	}
+	// end[i] is the index after the last node below i in preorder
+	end := make([]int, len(tree))
+	for i := len(tree) - 1; i >= 0; i-- {
+		end[i] = i + 1
+		if children := tree[i].children; len(children) > 0 {
+			end[i] = end[children[len(children)-1]]
+		}
+	}
+
+	// the context -1 is above the root, the root is its only child and all nodes are below it
+	contexts := []int{-1}
+	for _, step := range s.steps {
+		selected := make([]bool, len(tree))
+		candidates := func(context int) []int {
+			switch {
+			case step.descendant:
+				begin, stop := context+1, len(tree)
+				if context >= 0 {
+					stop = end[context]
+				}
+				below := make([]int, 0, stop-begin)
+				for i := begin; i < stop; i++ {
+					below = append(below, i)
+				}
+				return below
+			case context < 0:
+				return []int{0}
+			}
+			return tree[context].children
+		}
+		if step.descendant && !step.positional() {
+			// HINT: without positions a descendant step selects the same nodes from all contexts at once,
+			// every node below any context is checked once instead of once per context above it
+			covered := -1
+			next := 0
+			for i := range tree {
+				for next < len(contexts) && contexts[next] < i {
+					if contexts[next] < 0 {
+						covered = len(tree)
+					} else {
+						covered = max(covered, end[contexts[next]])
+					}
+					next++
+				}
+				selected[i] = i < covered && step.matches(selectorContext{node: tree[i].node, depth: depth[i]})
+			}
+		} else {
+			for _, context := range contexts {
+				for _, i := range step.filter(candidates(context), func(i int) selectorContext {
+					return selectorContext{node: tree[i].node, depth: depth[i]}
+				}) {
+					selected[i] = true
+				}
+			}
+		}
+		contexts = contexts[:0]
+		for i, ok := range selected {
+			if ok {
+				contexts = append(contexts, i)
+			}
+		}
+	}
+
+	result := make([]Match, 0, len(contexts))
+	for _, i := range contexts {
+		path := make([]string, depth[i]+1)
+		for j, k := depth[i], i; k >= 0; j, k = j-1, tree[k].parent {
+			path[j] = tree[k].node.GetName()
+		}
+		result = append(result, Match{Node: tree[i].node, Path: path})
+	}
+	return result
+}
+
+// positional reports whether the step has a position predicate.
+func (step selectorStep) positional() bool {
+	for _, predicate := range step.predicates {
+		if predicate.position > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matches checks the name and conditions of the step, positions are left to filter.
+func (step selectorStep) matches(c selectorContext) bool {
+	if step.name != "" && c.node.GetName() != step.name {
+		return false
+	}
+	for _, predicate := range step.predicates {
+		if predicate.condition != nil && !predicate.condition(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// filter returns candidates selected by the step from one context. Predicates are applied in order,
+// so a position counts only candidates passing the predicates before it.
+func (step selectorStep) filter(candidates []int, context func(i int) selectorContext) []int {
+	var kept []int
+	for _, i := range candidates {
+		if step.name == "" || context(i).node.GetName() == step.name {
+			kept = append(kept, i)
+		}
+	}
+	for _, predicate := range step.predicates {
+		candidates, kept = kept, nil
+		for position, i := range candidates {
+			if predicate.position > 0 && position+1 == predicate.position ||
+				predicate.condition != nil && predicate.condition(context(i)) {
+				kept = append(kept, i)
+			}
+		}
+	}
+	return kept
+}
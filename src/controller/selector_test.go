@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+func TestSelector(t *testing.T) {
+	tags := parseTags(t, attributedTags)
+	// HINT: UTF-8 of à and Å ends with bytes 0xA0 and 0x85, which are spaces when taken as runes alone
+	accented := *repository.NewNode().SetName("Å").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("à"),
+		*repository.NewNode().SetName("b"),
+	})
+	testCases := []struct {
+		name          string
+		root          repository.GNode
+		query         string
+		expected      string
+		expectedError bool
+	}{
+		{name: "Test child steps", root: exampleGraph(), query: "/A/C/H", expected: "A/C/H"},
+		{name: "Test absolute root", root: exampleGraph(), query: "/C", expected: ""},
+		{name: "Test descendant", root: exampleGraph(), query: "//C//*", expected: "A/C/G A/C/H A/C/I"},
+		{name: "Test relative", root: exampleGraph(), query: "D/*", expected: "A/D/J"},
+		{name: "Test wildcard", root: exampleGraph(), query: "/A/*/*[leaf]", expected: "A/B/E A/B/F A/C/G A/C/H A/C/I A/D/J"},
+		{name: "Test name operators", root: exampleGraph(), query: `//*[name~="^[EJ]$" or name="H"]`, expected: "A/B/E A/C/H A/D/J"},
+		{name: "Test depth and children", root: exampleGraph(), query: "//*[depth=1 and children>=2]", expected: "A/B A/C"},
+		{name: "Test not and parentheses", root: exampleGraph(), query: "//*[leaf and not (name=E or name=G)]", expected: "A/B/F A/C/H A/C/I A/D/J"},
+		{name: "Test position", root: exampleGraph(), query: "/A/*/*[1]", expected: "A/B/E A/C/G A/D/J"},
+		{name: "Test position after condition", root: exampleGraph(), query: "/A/C/*[name!=G][2]", expected: "A/C/I"},
+		{name: "Test each node once", root: exampleGraph(), query: "//*//*[leaf]", expected: "A/B/E A/B/F A/C/G A/C/H A/C/I A/D/J"},
+		{name: "Test root", root: exampleGraph(), query: "//*[root]", expected: "A"},
+		{name: "Test attribute exists", root: tags, query: "//*[@young]", expected: "animals/dogs/puppies"},
+		{name: "Test attribute array", root: tags, query: `//*[@aliases^="fel"]`, expected: "animals/cats"},
+		{name: "Test attribute object", root: tags, query: `//*[@translations.de=Hunde]`, expected: "animals/dogs"},
+		{name: "Test attribute number", root: tags, query: `//*[@legs<3]`, expected: "animals/birds"},
+		{name: "Test quoted name", root: tags, query: `//"dogs"/*`, expected: "animals/dogs/puppies"},
+		{name: "Test non-ASCII names", root: accented, query: "//à", expected: "Å/à"},
+		{name: "Test non-ASCII path", root: accented, query: "/Å/*[name^=à or name=b]", expected: "Å/à Å/b"},
+		{name: "Test unknown condition", root: tags, query: "//*[big]", expectedError: true},
+		{name: "Test number operator on text", root: tags, query: "//*[depth^=1]", expectedError: true},
+		{name: "Test unclosed predicate", root: tags, query: "//*[leaf", expectedError: true},
+		{name: "Test unclosed string", root: tags, query: `//"dogs`, expectedError: true},
+		{name: "Test bad regexp", root: tags, query: `//*[name~="("]`, expectedError: true},
+		{name: "Test zero position", root: tags, query: "//*[0]", expectedError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selector, err := ParseSelector(tc.query)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Expected error %v, but got %v", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			var actual []string
+			for _, match := range selector.Select(tc.root) {
+				actual = append(actual, strings.Join(match.Path, "/"))
+			}
+			if strings.Join(actual, " ") != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, strings.Join(actual, " "))
+			}
+		})
+	}
+}
+
+func TestQueryEndpoint(t *testing.T) {
+	server := tagServer{tags: newTagStore(parseTags(t, attributedTags), "")}
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expected       []queryNode
+	}{
+		{
+			name:           "Test query",
+			query:          `//dogs//*[leaf]`,
+			expectedStatus: http.StatusOK,
+			expected:       []queryNode{{Name: "puppies", Depth: 2, Path: []string{"animals", "dogs", "puppies"}, Attributes: map[string]interface{}{"id": "p1", "young": true}}},
+		},
+		{name: "Test no match", query: "//horses", expectedStatus: http.StatusOK, expected: []queryNode{}},
+		{name: "Test missing query", query: "", expectedStatus: http.StatusBadRequest},
+		{name: "Test invalid query", query: "//*[", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/query?token="+repository.GetValidToken()+"&q="+url.QueryEscape(tc.query), nil)
+			recorder := httptest.NewRecorder()
+			server.query(recorder, request)
+			if recorder.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, but got %d", tc.expectedStatus, recorder.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			var result queryResult
+			if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			expected, _ := json.Marshal(queryResult{Query: tc.query, Matches: tc.expected})
+			actual, _ := json.Marshal(result)
+			if string(actual) != string(expected) {
+				t.Errorf("Expected %s, but got %s", expected, actual)
+			}
+			if recorder.Header().Get("ETag") == "" {
+				t.Error("Expected ETag")
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"math"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// nodeIdentity returns what identifies a node which may be reached from more parents: nodes of
+// repository.Graph loaded by UploadGraph, subtrees of repository.Tree and other nodes held by pointer.
+// HINT: GNode says nothing about identity and MyNode values can not even be compared, so a MyNode
+// has none and every MyNode counts as a node of its own, as it does in trees loaded by UploadJson
+func nodeIdentity(node repository.GNode) (repository.GNode, bool) {
+	switch node.(type) {
+	case *repository.GraphNode, *repository.Tree, *repository.MyNode:
+		return node, true
+	}
+	return nil, false
+}
+
+// addSaturating adds counts, sums beyond the range of uint64 stay at its maximum.
+func addSaturating(a uint64, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+// PathStats describes root-to-leaf paths as returned by Paths, without building them.
+// Lengths are numbers of edges. Counts saturate at the maximum of uint64.
+type PathStats struct {
+	// Nodes is the number of nodes WalkGraph would return, a shared subtree counts every time it is reached.
+	Nodes         uint64
+	Paths         uint64
+	MinLength     int
+	MaxLength     int
+	AverageLength float64
+	// LengthHistogram is the number of paths by their length, which is the depth of their leaf.
+	LengthHistogram []uint64
+}
+
+// PathStatistics computes statistics of all paths in time linear in the size of the input, also when
+// nodes with identity (see nodeIdentity), e.g. of a DAG loaded by UploadGraph, are shared by more parents.
+// It walks the graph level by level and keeps every such node of a level once, with the number of paths
+// it is reached by. The graph must not have cycles.
+func PathStatistics(root repository.GNode) PathStats {
+	var stats PathStats
+	if root == nil {
+		return stats
+	}
+	type state struct {
+		node  repository.GNode
+		count uint64
+	}
+	var sum float64
+	level := []state{{node: root, count: 1}}
+	for depth := 0; len(level) > 0; depth++ {
+		var next []state
+		positions := make(map[repository.GNode]int)
+		for _, current := range level {
+			stats.Nodes = addSaturating(stats.Nodes, current.count)
+			children := current.node.GetChildren()
+			if len(children) == 0 {
+				for len(stats.LengthHistogram) <= depth {
+					stats.LengthHistogram = append(stats.LengthHistogram, 0)
+				}
+				stats.LengthHistogram[depth] = addSaturating(stats.LengthHistogram[depth], current.count)
+				continue
+			}
+			for _, child := range children {
+				key, ok := nodeIdentity(child)
+				if !ok {
+					next = append(next, state{node: child, count: current.count})
+					continue
+				}
+				if position, ok := positions[key]; ok {
+					next[position].count = addSaturating(next[position].count, current.count)
+					continue
+				}
+				positions[key] = len(next)
+				next = append(next, state{node: child, count: current.count})
+			}
+		}
+		level = next
+	}
+	stats.MinLength = -1
+	for length, count := range stats.LengthHistogram {
+		if count == 0 {
+			continue
+		}
+		if stats.MinLength < 0 {
+			stats.MinLength = length
+		}
+		stats.MaxLength = length
+		stats.Paths = addSaturating(stats.Paths, count)
+		sum += float64(length) * float64(count)
+	}
+	stats.AverageLength = sum / float64(stats.Paths)
+	return stats
+}
+
+// CountPaths returns the number of root-to-leaf paths, the length of what Paths would return.
+func CountPaths(root repository.GNode) uint64 {
+	if root == nil {
+		return 0
+	}
+	return countLeaves(root, make(map[repository.GNode]uint64))
+}
+
+// countLeaves returns the number of leaves below node, a leaf reached by more paths is counted for each of them.
+// Counts of nodes with identity are kept in memo, so a shared node is counted once.
+func countLeaves(node repository.GNode, memo map[repository.GNode]uint64) uint64 {
+	children := node.GetChildren()
+	if len(children) == 0 {
+		return 1
+	}
+	key, identified := nodeIdentity(node)
+	if identified {
+		if count, ok := memo[key]; ok {
+			return count
+		}
+	}
+	var count uint64
+	for _, child := range children {
+		count = addSaturating(count, countLeaves(child, memo))
+	}
+	if identified {
+		memo[key] = count
+	}
+	return count
+}
+
+// SubtreeLeaves is the number of leaves below an inner node.
+type SubtreeLeaves struct {
+	Name   string
+	Depth  int
+	Leaves uint64
+}
+
+// LeafCounts returns leaf counts of inner nodes in preorder. A shared node (see nodeIdentity) is listed
+// only where it is reached first, leaves are left out as each of them counts one.
+func LeafCounts(root repository.GNode) []SubtreeLeaves {
+	var counts []SubtreeLeaves
+	if root == nil {
+		return counts
+	}
+	memo := make(map[repository.GNode]uint64)
+	var visit func(node repository.GNode, depth int) uint64
+	// HINT: counts are filled in when children are done, so every node is counted once, not once per ancestor
+	visit = func(node repository.GNode, depth int) uint64 {
+		children := node.GetChildren()
+		if len(children) == 0 {
+			return 1
+		}
+		key, identified := nodeIdentity(node)
+		if count, listed := memo[key]; identified && listed {
+			return count
+		}
+		position := len(counts)
+		counts = append(counts, SubtreeLeaves{Name: node.GetName(), Depth: depth})
+		var leaves uint64
+		for _, child := range children {
+			leaves = addSaturating(leaves, visit(child, depth+1))
+		}
+		counts[position].Leaves = leaves
+		if identified {
+			memo[key] = leaves
+		}
+		return leaves
+	}
+	visit(root, 0)
+	return counts
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// diamonds loads a DAG of levels diamonds in a row by UploadGraph, every diamond doubles the number of paths.
+func diamonds(t *testing.T, levels int) repository.GNode {
+	var nodes []string
+	for i := 1; i <= levels; i++ {
+		below := fmt.Sprintf("top%d", i+1)
+		if i == levels {
+			below = "bottom"
+		}
+		nodes = append(nodes,
+			fmt.Sprintf(`{"id": "top%d", "children": ["left%d", "right%d"]}`, i, i, i),
+			fmt.Sprintf(`{"id": "left%d", "children": [%q]}`, i, below),
+			fmt.Sprintf(`{"id": "right%d", "children": [%q]}`, i, below))
+	}
+	nodes = append(nodes, `{"id": "bottom"}`)
+	graph := uploadGraph(t, `{"nodes": [`+strings.Join(nodes, ",")+`]}`)
+	return graph.Roots()[0]
+}
+
+func TestPathStatistics(t *testing.T) {
+	uneven := *repository.NewNode().SetName("A").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("B"),
+		*repository.NewNode().SetName("C").SetChildren([]repository.GNode{
+			*repository.NewNode().SetName("D").SetChildren([]repository.GNode{*repository.NewNode().SetName("E")}),
+			*repository.NewNode().SetName("F"),
+		}),
+	})
+	testCases := []struct {
+		name     string
+		input    repository.GNode
+		expected PathStats
+	}{
+		{name: "Test no node", input: nil, expected: PathStats{}},
+		{name: "Test one node", input: repository.NewNode().SetName("A"), expected: PathStats{Nodes: 1, Paths: 1, LengthHistogram: []uint64{1}}},
+		{
+			name:     "Test example graph",
+			input:    exampleGraph(),
+			expected: PathStats{Nodes: 10, Paths: 6, MinLength: 2, MaxLength: 2, AverageLength: 2, LengthHistogram: []uint64{0, 0, 6}},
+		},
+		{
+			name:     "Test uneven tree",
+			input:    uneven,
+			expected: PathStats{Nodes: 6, Paths: 3, MinLength: 1, MaxLength: 3, AverageLength: 2, LengthHistogram: []uint64{0, 1, 1, 1}},
+		},
+		{
+			name:     "Test DAG",
+			input:    diamonds(t, 3),
+			expected: PathStats{Nodes: 1 + 2 + 2 + 4 + 4 + 8 + 8, Paths: 8, MinLength: 6, MaxLength: 6, AverageLength: 6, LengthHistogram: []uint64{0, 0, 0, 0, 0, 0, 8}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := PathStatistics(tc.input)
+			if fmt.Sprintf("%+v", stats) != fmt.Sprintf("%+v", tc.expected) {
+				t.Errorf("Expected %+v, but got %+v", tc.expected, stats)
+			}
+			if tc.input != nil && CountPaths(tc.input) != uint64(len(Paths(tc.input))) {
+				t.Errorf("Expected %d paths counted, but got %d", len(Paths(tc.input)), CountPaths(tc.input))
+			}
+		})
+	}
+}
+
+// 100 diamonds have 2^100 paths, Paths would never finish, statistics are instant and saturate.
+func TestPathStatisticsHugeDAG(t *testing.T) {
+	dag := diamonds(t, 100)
+	stats := PathStatistics(dag)
+	if stats.Paths != math.MaxUint64 || stats.MaxLength != 200 || CountPaths(dag) != math.MaxUint64 {
+		t.Errorf("Expected saturated counts, but got %+v", stats)
+	}
+	// top, left and right of every diamond are listed once, though the top is reached by 2^i paths
+	if counts := LeafCounts(dag); len(counts) != 300 {
+		t.Errorf("Expected every shared subtree listed once, but got %d", len(counts))
+	}
+}
+
+func TestLeafCounts(t *testing.T) {
+	expected := []SubtreeLeaves{{Name: "A", Depth: 0, Leaves: 6}, {Name: "B", Depth: 1, Leaves: 2}, {Name: "C", Depth: 1, Leaves: 3}, {Name: "D", Depth: 1, Leaves: 1}}
+	if counts := LeafCounts(exampleGraph()); fmt.Sprint(counts) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, but got %v", expected, counts)
+	}
+	if counts := LeafCounts(nil); len(counts) != 0 {
+		t.Errorf("Expected no counts, but got %v", counts)
+	}
+}
@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// tagTree is a snapshot of the tags served by tagServer. A snapshot is never modified
+// after it was published, reload always builds and swaps in a new one.
+type tagTree struct {
+	root    *repository.Tree
+	version uint64
+	loaded  time.Time
+	// nodes is the number of tags in the tree, counted once when the tree is loaded.
+	nodes int
+	// lca is built by first relationship query on the tree, most trees never get one
+	lcaOnce sync.Once
+	lca     *LCAIndex
+}
+
+// lcaIndex returns the LCA index of the tree, building it on first use.
+func (t *tagTree) lcaIndex() *LCAIndex {
+	t.lcaOnce.Do(func() {
+		t.lca = NewLCAIndex(t.root)
+	})
+	return t.lca
+}
+
+// tagStore holds the current tagTree and replaces it atomically when the source file changes or
+// the tags are updated, so requests in flight keep working with the snapshot they started with.
+// Snapshots hold persistent trees, an update shares all tags it did not touch with the previous one.
+type tagStore struct {
+	current atomic.Pointer[tagTree]
+	source  string
+	// HINT: serializes reloads coming from the poller and from SIGHUP at the same time, and updates
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// newTagStore creates a store serving the given root. The source is the file the root was
+// loaded from and it is used on reload; an empty source disables reloading.
+func newTagStore(root repository.GNode, source string) *tagStore {
+	store := &tagStore{source: source}
+	tree := repository.NewTree(root)
+	store.current.Store(&tagTree{
+		root:    tree,
+		version: 1,
+		loaded:  time.Now(),
+		nodes:   tree.Size(),
+	})
+	if source != "" {
+		if info, err := os.Stat(source); err == nil {
+			store.modTime, store.size = info.ModTime(), info.Size()
+		}
+	}
+	return store
+}
+
+// load returns the snapshot currently being served.
+func (s *tagStore) load() *tagTree {
+	return s.current.Load()
+}
+
+// Reload re-parses the source file and swaps the served tree when the new one is valid.
+// On any error the previous tree is kept and the error is returned.
+func (s *tagStore) Reload() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.source == "" {
+		return fmt.Errorf("tags were not loaded from file, nothing to reload")
+	}
+	if info, err := os.Stat(s.source); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+
+	root, err := UploadJson(s.source)
+	if err != nil {
+		return err
+	}
+	if err := validateTags(root); err != nil {
+		return err
+	}
+
+	previous, next := s.publish(repository.NewTree(root))
+	added, removed := diffTags(previous, next)
+	logger.Info("Tags reloaded",
+		"source", s.source,
+		"version_from", previous.version, "version_to", next.version,
+		"nodes_from", previous.nodes, "nodes_to", next.nodes,
+		"added", len(added), "added_tags", shortList(added),
+		"removed", len(removed), "removed_tags", shortList(removed))
+	return nil
+}
+
+// Update applies the edit to the current tree and serves the tree it returns, e.g.
+//
+//	store.Update(func(root *repository.Tree) (*repository.Tree, error) {
+//		return root.Insert([]int{0}, -1, repository.TreeOf("puppies"))
+//	})
+//
+// Edits of Tree copy only the path to the edited tag and only tags created by the edit are validated,
+// so an update costs the depth of the tree (and the size of an inserted subtree), not the size of the tree.
+// Requests reading the previous tree are not affected. On error the current tree is kept.
+func (s *tagStore) Update(edit func(root *repository.Tree) (*repository.Tree, error)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	current := s.load().root
+	root, err := edit(current)
+	if err != nil {
+		return err
+	}
+	if err := validateEdit(current, root); err != nil {
+		return err
+	}
+	previous, next := s.publish(root)
+	logger.Info("Tags updated", "version_from", previous.version, "version_to", next.version, "nodes_from", previous.nodes, "nodes_to", next.nodes)
+	return nil
+}
+
+// publish swaps in a new snapshot of the root, the caller holds the mutex.
+func (s *tagStore) publish(root *repository.Tree) (previous *tagTree, next *tagTree) {
+	previous = s.load()
+	next = &tagTree{
+		root:    root,
+		version: previous.version + 1,
+		loaded:  time.Now(),
+		nodes:   root.Size(),
+	}
+	s.current.Store(next)
+	return previous, next
+}
+
+// watch reloads the tags whenever the source file changes (polled every interval) or SIGHUP is received.
+// It returns once the ctx is canceled.
+func (s *tagStore) watch(ctx context.Context, interval time.Duration) {
+	if s.source == "" {
+		return
+	}
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	if interval <= 0 {
+		interval = DefaultConfig().ReloadInterval
+	}
+	// HINT: polling instead of inotify keeps us on standard library and works on mounted volumes too
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			s.reloadAndLog()
+		case <-ticker.C:
+			if s.changed() {
+				s.reloadAndLog()
+			}
+		}
+	}
+}
+
+// changed reports whether the source file was modified since the last reload.
+func (s *tagStore) changed() bool {
+	info, err := os.Stat(s.source)
+	if err != nil {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+}
+
+func (s *tagStore) reloadAndLog() {
+	if err := s.Reload(); err != nil {
+		logger.Error("Keeping previous tags, reload failed", "source", s.source, "version", s.load().version, "error", err)
+	}
+}
+
+// validateTags checks that the tree has a root and every tag in it has a name.
+func validateTags(root repository.GNode) error {
+	if root == nil {
+		return fmt.Errorf("tags have no root")
+	}
+	stack := []repository.GNode{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node.GetName() == "" {
+			return fmt.Errorf("tag without name found")
+		}
+		stack = append(stack, node.GetChildren()...)
+	}
+	return nil
+}
+
+// validateEdit checks tags of next which are not shared with previous as validateTags does, the previous tree is valid already.
+// A new tag is mostly a copy of a previous one, its children are compared with children of that one. Tags of an inserted subtree
+// are all checked, so is a subtree moved from elsewhere, which is only slower.
+func validateEdit(previous *repository.Tree, next *repository.Tree) error {
+	if next == nil {
+		return fmt.Errorf("tags have no root")
+	}
+	if next == previous {
+		return nil
+	}
+	type edited struct {
+		node *repository.Tree
+		// old are children of the previous tags the node may be a copy of
+		old []repository.GNode
+	}
+	stack := []edited{{node: next, old: previous.GetChildren()}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.node.GetName() == "" {
+			return fmt.Errorf("tag without name found")
+		}
+		children := top.node.GetChildren()
+		kept := make(map[repository.GNode]bool, len(children))
+		for _, child := range children {
+			kept[child] = true
+		}
+		// HINT: a new child is a copy of one of the old children gone from the node, if it is a copy at all
+		var replaced []repository.GNode
+		shared := make(map[repository.GNode]bool, len(top.old))
+		for _, old := range top.old {
+			shared[old] = true
+			if !kept[old] {
+				replaced = append(replaced, old.GetChildren()...)
+			}
+		}
+		for _, child := range children {
+			if !shared[child] {
+				stack = append(stack, edited{node: child.(*repository.Tree), old: replaced})
+			}
+		}
+	}
+	return nil
+}
+
+// diffTags returns which tag names were added and removed between two snapshots.
+func diffTags(previous *tagTree, next *tagTree) (added []string, removed []string) {
+	before := countTags(previous.root)
+	after := countTags(next.root)
+
+	for name, count := range before {
+		if after[name] < count {
+			removed = append(removed, name)
+		}
+	}
+	for name, count := range after {
+		if before[name] < count {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// countTags returns how many times each tag name occurs in the tree.
+func countTags(root repository.GNode) map[string]int {
+	counts := make(map[string]int)
+	for _, node := range WalkGraph(root) {
+		counts[node.GetName()]++
+	}
+	return counts
+}
+
+// shortList formats names for a log line, abbreviating long lists.
+func shortList(names []string) string {
+	const limit = 10
+	if len(names) > limit {
+		return "[" + strings.Join(names[:limit], ", ") + fmt.Sprintf(", ... %d more]", len(names)-limit)
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+func writeTags(t *testing.T, filename string, content string) {
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTagStoreReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "tags.json")
+	writeTags(t, filename, `{"name": "animals", "children": [{"name": "dogs", "children": []}]}`)
+	root, err := UploadJson(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newTagStore(root, filename)
+
+	tests := []struct {
+		name            string
+		content         string
+		expectedError   bool
+		expectedVersion uint64
+		expectedTags    int
+	}{
+		{
+			name:            "valid file is swapped in",
+			content:         `{"name": "animals", "children": [{"name": "dogs"}, {"name": "cats"}]}`,
+			expectedVersion: 2,
+			expectedTags:    3,
+		},
+		{
+			name:            "broken json keeps previous tree",
+			content:         `{"name": "animals", "children": [`,
+			expectedError:   true,
+			expectedVersion: 2,
+			expectedTags:    3,
+		},
+		{
+			name:            "tag without name keeps previous tree",
+			content:         `{"name": "animals", "children": [{"children": []}]}`,
+			expectedError:   true,
+			expectedVersion: 2,
+			expectedTags:    3,
+		},
+		{
+			name:            "name of wrong type keeps previous tree",
+			content:         `{"name": 42}`,
+			expectedError:   true,
+			expectedVersion: 2,
+			expectedTags:    3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			writeTags(t, filename, tc.content)
+			err := store.Reload()
+			if (err != nil) != tc.expectedError {
+				t.Errorf("Expected error %v, but got %v", tc.expectedError, err)
+			}
+			tree := store.load()
+			if tree.version != tc.expectedVersion {
+				t.Errorf("Expected version %d, but got %d", tc.expectedVersion, tree.version)
+			}
+			if len(WalkGraph(tree.root)) != tc.expectedTags {
+				t.Errorf("Expected %d tags, but got %d", tc.expectedTags, len(WalkGraph(tree.root)))
+			}
+		})
+	}
+}
+
+func TestTagStoreWatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "tags.json")
+	writeTags(t, filename, `{"name": "animals"}`)
+	root, err := UploadJson(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newTagStore(root, filename)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.watch(ctx, 10*time.Millisecond)
+
+	writeTags(t, filename, `{"name": "animals", "children": [{"name": "birds"}]}`)
+	deadline := time.Now().Add(2 * time.Second)
+	for store.load().version == 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if children := store.load().root.GetChildren(); len(children) != 1 || children[0].GetName() != "birds" {
+		t.Errorf("Expected watched file to be reloaded, but got %v", children)
+	}
+}
+
+// Requests keep reading their snapshot while the tags are updated, run with -race.
+func TestTagStoreUpdate(t *testing.T) {
+	store := newTagStore(exampleGraph(), "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for ctx.Err() == nil {
+				tree := store.load()
+				if nodes := len(WalkGraph(tree.root)); nodes != tree.nodes {
+					t.Errorf("Expected %d tags in version %d, but got %d", tree.nodes, tree.version, nodes)
+					return
+				}
+				repository.GetSubTags(ctx, tree.root, "J")
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		err := store.Update(func(root *repository.Tree) (*repository.Tree, error) {
+			path, _ := root.Find("D")
+			return root.Insert(path, -1, repository.TreeOf("K"+strconv.Itoa(i)))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	readers.Wait()
+
+	tree := store.load()
+	if tree.version != 101 || tree.nodes != 110 {
+		t.Errorf("Expected version 101 with 110 tags, but got version %d with %d tags", tree.version, tree.nodes)
+	}
+	if err := store.Update(func(root *repository.Tree) (*repository.Tree, error) { return root.Rename(nil, "") }); err == nil {
+		t.Error("Expected update to a tag without name to fail")
+	}
+	if err := store.Update(func(root *repository.Tree) (*repository.Tree, error) { return root.Rename([]int{1, 2}, "") }); err == nil {
+		t.Error("Expected update renaming a deep tag to nothing to fail")
+	}
+	if err := store.Update(func(root *repository.Tree) (*repository.Tree, error) {
+		return root.Insert([]int{1}, 0, repository.TreeOf("X", repository.TreeOf("Y", repository.TreeOf(""))))
+	}); err == nil {
+		t.Error("Expected update inserting a tag without name to fail")
+	}
+	if store.load() != tree {
+		t.Error("Expected failed updates to keep the tree")
+	}
+}
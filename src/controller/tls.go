@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves the certificate from CertFile and KeyFile and re-reads them
+// when they are rotated on disk. A broken rotation keeps the previous certificate.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mutex    sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+}
+
+// certCheckInterval limits how often files are stat-ed during handshakes.
+const certCheckInterval = time.Second
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// reload reads the key pair from disk, it has to be called with mutex held or before first use.
+func (r *certReloader) reload() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert, r.modTime = &cert, modTime
+	return nil
+}
+
+// lastModified returns the newer modification time of the certificate and key files.
+func (r *certReloader) lastModified() (time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if time.Since(r.checked) >= certCheckInterval {
+		r.checked = time.Now()
+		if modTime, err := r.lastModified(); err == nil && !modTime.Equal(r.modTime) {
+			if err := r.reload(); err != nil {
+				logger.Error("Keeping previous certificate, reload failed", "cert_file", r.certFile, "error", err)
+			} else {
+				logger.Info("Certificate reloaded", "cert_file", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// tlsConfig builds the TLS configuration for the server, nil is returned when TLS is not configured.
+func tlsConfig(config Config) (*tls.Config, error) {
+	if !config.TLS() {
+		if config.ClientCAFile != "" {
+			return nil, fmt.Errorf("client CA requires certificate and key of the server")
+		}
+		return nil, nil
+	}
+	reloader, err := newCertReloader(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	result := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.ClientCAFile)
+		}
+		result.ClientCAs = pool
+		result.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.RequireClientCert {
+			result.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return result, nil
+}
+
+// clientIdentity returns the identity mapped to the verified client certificate of the request.
+// Subjects are tried in order: common name, DNS names and URIs of the certificate.
+func clientIdentity(request *http.Request, identities map[string]string) (string, bool) {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(identities) == 0 {
+		return "", false
+	}
+	cert := request.TLS.VerifiedChains[0][0]
+	subjects := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	for _, subject := range subjects {
+		if identity, ok := identities[subject]; ok && subject != "" {
+			return identity, true
+		}
+	}
+	return "", false
+}
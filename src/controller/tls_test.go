@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// testCert is a generated certificate with its key, signed by parent (self-signed when parent is nil).
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, serial int64, commonName string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write stores certificate and key as PEM files and returns their paths.
+func (c *testCert) write(t *testing.T, dir string, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, "ca", nil)
+	certFile, keyFile := newTestCert(t, 2, "server", ca).write(t, dir, "server")
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial := func() int64 {
+		cert, err := reloader.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.SerialNumber.Int64()
+	}
+	if serial() != 2 {
+		t.Fatalf("Expected serial 2, but got %d", serial())
+	}
+
+	// rotation
+	newTestCert(t, 3, "server", ca).write(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	reloader.checked = time.Time{}
+	if serial() != 3 {
+		t.Errorf("Expected rotated serial 3, but got %d", serial())
+	}
+
+	// broken rotation keeps previous certificate
+	os.WriteFile(certFile, []byte("garbage"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	reloader.checked = time.Time{}
+	if serial() != 3 {
+		t.Errorf("Expected previous serial 3 to be kept, but got %d", serial())
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, "ca", nil)
+	certFile, keyFile := newTestCert(t, 2, "server", ca).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	config := DefaultConfig()
+	config.CertFile, config.KeyFile, config.ClientCAFile = certFile, keyFile, caFile
+	config.ClientIdentities, _ = ParseIdentities("frontend=web")
+	serverTLS, err := tlsConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := *repository.NewNode().SetName("root").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("child1"),
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: &tagServer{
+		tags:       newTagStore(node, ""),
+		identities: config.ClientIdentities,
+	}}
+	go server.Serve(tls.NewListener(listener, serverTLS))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	url := "https://" + listener.Addr().String() + "/taggedContent?tag=child1"
+
+	tests := []struct {
+		name           string
+		clientCert     *testCert
+		token          string
+		expectedStatus int
+	}{
+		{name: "mapped client certificate", clientCert: newTestCert(t, 3, "frontend", ca), expectedStatus: http.StatusOK},
+		{name: "unmapped client certificate", clientCert: newTestCert(t, 4, "intruder", ca), expectedStatus: http.StatusUnauthorized},
+		{name: "unmapped client certificate with token", clientCert: newTestCert(t, 5, "intruder", ca), token: repository.GetValidToken(), expectedStatus: http.StatusOK},
+		{name: "no client certificate", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clientTLS := &tls.Config{RootCAs: roots}
+			if tc.clientCert != nil {
+				clientTLS.Certificates = []tls.Certificate{tc.clientCert.tlsCertificate()}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get(url + "&token=" + tc.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status %d, but got %d", tc.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/landrisek/cisco/src/tracing"
+)
+
+// newTracer creates the tracer for the configured exporter, nil means tracing is disabled.
+func newTracer(config Config) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch config.TraceExporter {
+	case "":
+		return nil, nil
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(config.OTLPEndpoint, config.ServiceName)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, use stdout or otlp", config.TraceExporter)
+	}
+	tracer := tracing.NewTracer(exporter, 512, 5*time.Second)
+	tracer.ErrorHandler = func(err error) {
+		logger.Warn("Error exporting spans", "exporter", config.TraceExporter, "error", err)
+	}
+	return tracer, nil
+}
+
+// traceRequests starts a server span for every request routed by the mux, continuing the trace
+// of the caller sent in traceparent header.
+func traceRequests(tracer *tracing.Tracer, mux *http.ServeMux, next http.Handler) http.Handler {
+	if tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, route := mux.Handler(request)
+		ctx, span := tracer.StartServer(request.Context(), request.Method+" "+route, request.Header)
+		defer span.End()
+		span.SetAttribute("http.method", request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("request.id", RequestID(ctx))
+		// HINT: let the client correlate its request with our trace
+		writer.Header().Set(tracing.TraceparentHeader, span.SpanContext().Traceparent())
+
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+		span.SetAttribute("http.status_code", fmt.Sprint(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("%s", http.StatusText(recorder.status)))
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+func TestTracing(t *testing.T) {
+	// fake OpenTelemetry collector
+	var mutex sync.Mutex
+	var spans []otlpTestSpan
+	collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/v1/traces" {
+			http.NotFound(writer, request)
+			return
+		}
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpTestSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, resource := range body.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				spans = append(spans, scope.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	children := make([]repository.GNode, 0, 12)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "target"} {
+		children = append(children, *repository.NewNode().SetName(name))
+	}
+	node := *repository.NewNode().SetName("root").SetChildren(children)
+	config := DefaultConfig()
+	config.TraceExporter = "otlp"
+	config.OTLPEndpoint = collector.URL
+	api, err := newAPIServer(node, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/taggedContent?tag=target&token="+repository.GetValidToken(), nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", recorder.Code)
+	}
+	api.shutdown(0, 0)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	byName := make(map[string][]otlpTestSpan)
+	for _, span := range spans {
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected every span in propagated trace, but %s is in %s", span.Name, span.TraceID)
+		}
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	server := byName["GET /taggedContent"]
+	if len(server) != 1 || server[0].ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("Expected one server span child of remote parent, but got %v", server)
+	}
+	for _, name := range []string{"authenticate", "GetSubTags", "encode"} {
+		if len(byName[name]) != 1 || byName[name][0].ParentSpanID != server[0].SpanID {
+			t.Errorf("Expected span %s under server span, but got %v", name, byName[name])
+		}
+	}
+	if len(byName["GetSubTags"]) == 1 {
+		if tasks := byName["pool task"]; len(tasks) == 0 || tasks[0].ParentSpanID != byName["GetSubTags"][0].SpanID {
+			t.Errorf("Expected pool task spans under GetSubTags, but got %v", tasks)
+		}
+	}
+	if recorder.Header().Get("traceparent") == "" {
+		t.Errorf("Expected traceparent in response")
+	}
+}
+
+type otlpTestSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+}
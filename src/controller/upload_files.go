@@ -21,12 +21,12 @@ func UploadJson(filename string) (repository.GNode, error) {
 	if err != nil {
 		return nil, err
 	}
-	return convertNode(node), nil
+	return convertNode(node)
 }
 
 // HINT: Acceptance criteria imply by using getter in interface GNode that fields ("class variables") should stay private.
 // On this assumption there is this workaround, otherwise with exported names it will work with unmarshall out of the box.
-func convertNode(n interface{}) repository.MyNode {
+func convertNode(n interface{}) (repository.MyNode, error) {
 	node := repository.MyNode{}
 	// we reach the bottom on subsequent branch of graph
 	switch n := n.(type) {
@@ -34,17 +34,200 @@ func convertNode(n interface{}) repository.MyNode {
 	case map[string]interface{}:
 		for k, v := range n {
 			if k == "name" {
-				if ok := node.SetName(v.(string)); ok == nil {
-					Log(fmt.Errorf("Immutability on tag`s name was broken"), fmt.Sprintf("Trying to replace %s with %s", node.GetName(), v.(string)))
+				name, ok := v.(string)
+				if !ok {
+					return node, fmt.Errorf("name of tag must be a string, got %T", v)
+				}
+				if ok := node.SetName(name); ok == nil {
+					return node, fmt.Errorf("immutability on tag`s name was broken, trying to replace %s with %s", node.GetName(), name)
+				}
+			} else if k == "weight" {
+				weight, ok := v.(float64)
+				if !ok {
+					return node, fmt.Errorf("weight of tag %v must be a number, got %T", n["name"], v)
+				}
+				node.SetWeight(weight)
+			} else if k == "attributes" {
+				attributes, ok := v.(map[string]interface{})
+				if !ok {
+					return node, fmt.Errorf("attributes of tag %v must be an object, got %T", n["name"], v)
+				}
+				for key, value := range attributes {
+					if err := setAttribute(&node, n, key, value); err != nil {
+						return node, err
+					}
 				}
 			} else if k == "children" {
-				children := v.([]interface{})
+				children, ok := v.([]interface{})
+				if !ok {
+					return node, fmt.Errorf("children of tag %v must be an array, got %T", n["name"], v)
+				}
 				for _, child := range children {
-					node.SetChildren(append(node.GetChildren(), convertNode(child)))
+					converted, err := convertNode(child)
+					if err != nil {
+						return node, err
+					}
+					node.SetChildren(append(node.GetChildren(), converted))
 				}
+			} else if err := setAttribute(&node, n, k, v); err != nil {
+				return node, err
+			}
+		}
+	}
+
+	return node, nil
+}
+
+// setAttribute keeps any other key of the tag as its attribute. Well known attributes are checked:
+// id and description are strings, aliases an array of strings and translations an object of strings by language.
+func setAttribute(node *repository.MyNode, n map[string]interface{}, key string, value interface{}) error {
+	valid := true
+	switch key {
+	case "name", "weight", "children":
+		return fmt.Errorf("attributes of tag %v can not contain %s", n["name"], key)
+	case "id", "description":
+		_, valid = value.(string)
+	case "aliases":
+		aliases, ok := value.([]interface{})
+		valid = ok
+		for _, alias := range aliases {
+			if _, ok := alias.(string); !ok {
+				valid = false
+			}
+		}
+	case "translations":
+		translations, ok := value.(map[string]interface{})
+		valid = ok
+		for _, translation := range translations {
+			if _, ok := translation.(string); !ok {
+				valid = false
+			}
+		}
+	}
+	if !valid {
+		return fmt.Errorf("%s of tag %v has wrong type %T", key, n["name"], value)
+	}
+	attributes := node.GetAttributes()
+	if attributes == nil {
+		attributes = make(map[string]interface{})
+		node.SetAttributes(attributes)
+	}
+	if _, ok := attributes[key]; ok {
+		return fmt.Errorf("attribute %s of tag %v is given twice", key, n["name"])
+	}
+	attributes[key] = value
+	return nil
+}
+
+// UploadGraph reads a directed graph from the file. Two formats are accepted:
+//   - {"nodes": [{"id": "a", "name": "A", "children": ["b", "c"]}, ...]} lists nodes with ids of their children,
+//   - a tree as for UploadJson, or an array of trees for more roots. Nodes with the same "id" are one node
+//     shared by more parents, a node without id is identified by its name. A child with only an id refers
+//     to a node defined elsewhere in the file.
+func UploadGraph(filename string) (*repository.Graph, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var input interface{}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, err
+	}
+	graph := repository.NewGraph()
+	switch input := input.(type) {
+	case map[string]interface{}:
+		if nodes, ok := input["nodes"]; ok {
+			return graph, convertNodeList(graph, nodes)
+		}
+		_, err := convertGraphNode(graph, input)
+		return graph, err
+	case []interface{}:
+		for _, root := range input {
+			if _, err := convertGraphNode(graph, root); err != nil {
+				return graph, err
+			}
+		}
+		return graph, nil
+	}
+	return graph, fmt.Errorf("graph must be an object or an array, got %T", input)
+}
+
+// convertNodeList adds nodes listed with ids of their children, edges are added once all nodes exist.
+func convertNodeList(graph *repository.Graph, nodes interface{}) error {
+	list, ok := nodes.([]interface{})
+	if !ok {
+		return fmt.Errorf("nodes must be an array, got %T", nodes)
+	}
+	edges := make(map[string][]interface{})
+	var ids []string
+	for _, item := range list {
+		n, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("node must be an object, got %T", item)
+		}
+		id, ok := n["id"].(string)
+		if !ok {
+			return fmt.Errorf("node %v must have a string id", n["name"])
+		}
+		name, ok := n["name"].(string)
+		if !ok {
+			name = id
+		}
+		if _, err := graph.AddNode(id, name); err != nil {
+			return err
+		}
+		if children, ok := n["children"].([]interface{}); ok {
+			edges[id] = append(edges[id], children...)
+			ids = append(ids, id)
+		}
+	}
+	// HINT: children may be listed before their node, so edges wait for all nodes
+	for _, id := range ids {
+		for _, child := range edges[id] {
+			childID, ok := child.(string)
+			if !ok {
+				return fmt.Errorf("children of node %s must be ids, got %T", id, child)
+			}
+			if err := graph.AddEdge(id, childID); err != nil {
+				return err
 			}
 		}
 	}
+	return nil
+}
 
-	return node
+// convertGraphNode adds the node of a tree with all its children to the graph and returns its id.
+func convertGraphNode(graph *repository.Graph, item interface{}) (string, error) {
+	n, ok := item.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("node must be an object, got %T", item)
+	}
+	name, hasName := n["name"].(string)
+	id, ok := n["id"].(string)
+	if !ok {
+		if !hasName {
+			return "", fmt.Errorf("node must have a string id or name")
+		}
+		id = name
+	}
+	if hasName {
+		if _, err := graph.AddNode(id, name); err != nil {
+			return "", err
+		}
+	} else if _, err := graph.AddReference(id); err != nil {
+		// a reference to the node defined elsewhere, maybe later in the file
+		return "", err
+	}
+	children, _ := n["children"].([]interface{})
+	for _, child := range children {
+		childID, err := convertGraphNode(graph, child)
+		if err != nil {
+			return "", err
+		}
+		if err := graph.AddEdge(id, childID); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
 }
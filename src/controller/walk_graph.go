@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"context"
+
 	"github.com/landrisek/cisco/src/repository"
 )
 
@@ -23,3 +25,51 @@ func findNode(node repository.GNode, nodes *[]repository.GNode) {
 		findNode(children, nodes)
 	}
 }
+
+// WalkGraphParallel returns the same nodes in the same preorder as WalkGraph, subtrees are walked on the pool.
+// Subtrees with fewer than threshold nodes are walked sequentially, as splitting them would cost more than it saves.
+func WalkGraphParallel(ctx context.Context, node repository.GNode, pool *repository.Pool, threshold int) ([]repository.GNode, error) {
+	if node == nil {
+		return []repository.GNode{}, nil
+	}
+	chunks, err := walkChunks(ctx, node, pool, threshold, splitBudget(pool))
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, chunk := range chunks {
+		size += len(chunk)
+	}
+	// HINT: chunks are merged once at the end, merging them on every level would copy the nodes again and again
+	nodes := make([]repository.GNode, 0, size)
+	for _, chunk := range chunks {
+		nodes = append(nodes, chunk...)
+	}
+	return nodes, nil
+}
+
+// walkChunks returns preorder of the subtree of node as consecutive chunks. The budget of subtrees
+// the walk may still split into is divided among children of node.
+func walkChunks(ctx context.Context, node repository.GNode, pool *repository.Pool, threshold int, budget int) ([][]repository.GNode, error) {
+	children := node.GetChildren()
+	if budget < 2 || len(children) == 0 || smallerThan(node, threshold) {
+		var nodes []repository.GNode
+		findNode(node, &nodes)
+		return [][]repository.GNode{nodes}, nil
+	}
+	childBudget := budget / len(children)
+	if childBudget < 1 {
+		childBudget = 1
+	}
+	results, err := repository.Map(ctx, pool, children, func(ctx context.Context, child repository.GNode) ([][]repository.GNode, error) {
+		return walkChunks(ctx, child, pool, threshold, childBudget)
+	})
+	if err != nil {
+		return nil, err
+	}
+	chunks := [][]repository.GNode{{node}}
+	for _, result := range results {
+		chunks = append(chunks, result...)
+	}
+	return chunks, nil
+}
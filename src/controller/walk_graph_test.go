@@ -1,8 +1,12 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/landrisek/cisco/src/repository"
@@ -133,3 +137,88 @@ func generateRandomTestCase(maxNodes int) testCase {
 		expectedContent: expectedContent,
 	}
 }
+
+// generateTree builds a full tree with fanout children per node and depth levels below the root.
+// Names are numbers in preorder, unless named is false, which spares memory of huge trees.
+func generateTree(fanout int, depth int, named bool) repository.GNode {
+	counter := 0
+	var build func(level int) repository.MyNode
+	build = func(level int) repository.MyNode {
+		node := repository.NewNode()
+		if named {
+			node.SetName(strconv.Itoa(counter))
+		}
+		counter++
+		if level < depth {
+			children := make([]repository.GNode, fanout)
+			for i := range children {
+				children[i] = build(level + 1)
+			}
+			node.SetChildren(children)
+		}
+		return *node
+	}
+	return build(0)
+}
+
+func TestWalkGraphParallel(t *testing.T) {
+	pool := repository.NewPool(4, 8)
+	defer pool.Close()
+	trees := map[string]repository.GNode{
+		"nil":     nil,
+		"one":     repository.NewNode().SetName("A"),
+		"random":  generateRandomTestCase(10).input,
+		"wide":    generateTree(50, 2, true),
+		"deep":    generateTree(2, 12, true),
+		"uneven":  repository.NewNode().SetName("root").SetChildren([]repository.GNode{generateTree(3, 7, true), repository.NewNode().SetName("leaf")}),
+		"chained": repository.NewNode().SetName("top").SetChildren([]repository.GNode{generateTree(4, 6, true)}),
+	}
+	for name, tree := range trees {
+		for _, threshold := range []int{1, 100, 1 << 30} {
+			t.Run(fmt.Sprintf("%s threshold %d", name, threshold), func(t *testing.T) {
+				expected := WalkGraph(tree)
+				nodes, err := WalkGraphParallel(context.Background(), tree, pool, threshold)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(nodes) != len(expected) {
+					t.Fatalf("Expected %d nodes, but got %d", len(expected), len(nodes))
+				}
+				for i := range nodes {
+					if nodes[i].GetName() != expected[i].GetName() {
+						t.Fatalf("Expected node %s at %d, but got %s", expected[i].GetName(), i, nodes[i].GetName())
+					}
+				}
+			})
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WalkGraphParallel(ctx, generateTree(10, 4, true), pool, 1); err != context.Canceled {
+		t.Errorf("Expected canceled walk, but got %v", err)
+	}
+}
+
+// benchmarkTree is built once, it has 11 111 111 nodes.
+var benchmarkTree = sync.OnceValue(func() repository.GNode {
+	return generateTree(10, 7, false)
+})
+
+func BenchmarkWalkGraph(b *testing.B) {
+	tree := benchmarkTree()
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			WalkGraph(tree)
+		}
+	})
+	for _, workers := range []int{1, 2, 4, runtime.NumCPU()} {
+		pool := repository.NewPool(workers, 64*workers)
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				WalkGraphParallel(context.Background(), tree, pool, 10000)
+			}
+		})
+		pool.Close()
+	}
+}
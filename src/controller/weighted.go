@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// weightOf returns the weight of the edge from the parent to node, 1 for nodes without weights.
+func weightOf(node repository.GNode) float64 {
+	if weighted, ok := node.(repository.Weighted); ok {
+		return weighted.GetWeight()
+	}
+	return 1
+}
+
+// weightedPath is the best path found below a node, next is the child it continues with and below the best path of next.
+type weightedPath struct {
+	weight float64
+	next   repository.GNode
+	below  *weightedPath
+	found  bool
+}
+
+// bestPaths finds the best weighted paths going down from nodes to the targets by dynamic programming.
+// A node with identity (see nodeIdentity) shared by more parents, e.g. in a DAG loaded by UploadGraph, is solved only once.
+// HINT: paths in a DAG never come back, so the best path below a node does not depend on how we got there
+type bestPaths struct {
+	better func(a float64, b float64) bool
+	target func(node repository.GNode) bool
+	memo   map[repository.GNode]*weightedPath
+}
+
+func (b *bestPaths) solve(node repository.GNode) *weightedPath {
+	key, identified := nodeIdentity(node)
+	if best, ok := b.memo[key]; identified && ok {
+		return best
+	}
+	best := &weightedPath{}
+	if b.target(node) {
+		best.found = true
+	} else {
+		for _, child := range node.GetChildren() {
+			below := b.solve(child)
+			if !below.found {
+				continue
+			}
+			weight := weightOf(child) + below.weight
+			if !best.found || b.better(weight, best.weight) {
+				best = &weightedPath{weight: weight, next: child, below: below, found: true}
+			}
+		}
+	}
+	if identified {
+		b.memo[key] = best
+	}
+	return best
+}
+
+// path follows the solved choices from node down to the target.
+func (b *bestPaths) path(node repository.GNode, best *weightedPath) []repository.GNode {
+	path := []repository.GNode{node}
+	for ; best.next != nil; best = best.below {
+		path = append(path, best.next)
+	}
+	return path
+}
+
+// start returns the node named from, the root when from is empty.
+func start(root repository.GNode, from string) (repository.GNode, error) {
+	if root == nil {
+		return nil, fmt.Errorf("graph is empty")
+	}
+	if from == "" {
+		return root, nil
+	}
+	path, _ := pathTo(root, from)
+	if path == nil {
+		return nil, fmt.Errorf("node %s not found", from)
+	}
+	return path[len(path)-1], nil
+}
+
+// ShortestPath returns the path going down from the node named from to the node named to with the minimal
+// sum of weights of its edges, together with the sum. Edges without weight count 1.
+func ShortestPath(root repository.GNode, from string, to string) ([]repository.GNode, float64, error) {
+	begin, err := start(root, from)
+	if err != nil {
+		return nil, 0, err
+	}
+	paths := &bestPaths{
+		better: func(a float64, b float64) bool { return a < b },
+		target: func(node repository.GNode) bool { return node.GetName() == to },
+		memo:   make(map[repository.GNode]*weightedPath),
+	}
+	best := paths.solve(begin)
+	if !best.found {
+		return nil, math.Inf(1), fmt.Errorf("node %s is not reachable from %s", to, begin.GetName())
+	}
+	return paths.path(begin, best), best.weight, nil
+}
+
+// CriticalPath returns the path going down from the node named from (the root when empty) to a leaf with
+// the maximal sum of weights of its edges, together with the sum. In a dependency graph it is the chain
+// which determines how long the whole takes.
+func CriticalPath(root repository.GNode, from string) ([]repository.GNode, float64, error) {
+	begin, err := start(root, from)
+	if err != nil {
+		return nil, 0, err
+	}
+	paths := &bestPaths{
+		better: func(a float64, b float64) bool { return a > b },
+		target: func(node repository.GNode) bool { return len(node.GetChildren()) == 0 },
+		memo:   make(map[repository.GNode]*weightedPath),
+	}
+	best := paths.solve(begin)
+	return paths.path(begin, best), best.weight, nil
+}
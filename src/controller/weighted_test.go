@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/landrisek/cisco/src/repository"
+)
+
+// weightedGraph is a DAG, F is shared by B and D. Weights of edges are in brackets, E -> F has the default 1.
+//
+//	A -(2)-> B -(1)-> F
+//	A -(1)-> C -(4)-> E -> F
+//	A -(6)-> D -(1)-> F
+func weightedGraph() repository.GNode {
+	f := *repository.NewNode().SetName("F")
+	shared := []repository.GNode{*repository.NewNode().SetName("F").SetWeight(1)}
+	return *repository.NewNode().SetName("A").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("B").SetWeight(2).SetChildren(shared),
+		*repository.NewNode().SetName("C").SetWeight(1).SetChildren([]repository.GNode{
+			*repository.NewNode().SetName("E").SetWeight(4).SetChildren([]repository.GNode{f}),
+		}),
+		*repository.NewNode().SetName("D").SetWeight(6).SetChildren(shared),
+	})
+}
+
+// duplicateNames has two different nodes named X, only the first one has a child.
+//
+//	A -(1)-> X -(10)-> L
+//	A -(5)-> Y -(1)-> X
+func duplicateNames() repository.GNode {
+	return *repository.NewNode().SetName("A").SetChildren([]repository.GNode{
+		*repository.NewNode().SetName("X").SetWeight(1).SetChildren([]repository.GNode{
+			*repository.NewNode().SetName("L").SetWeight(10),
+		}),
+		*repository.NewNode().SetName("Y").SetWeight(5).SetChildren([]repository.GNode{
+			*repository.NewNode().SetName("X").SetWeight(1),
+		}),
+	})
+}
+
+func TestShortestPath(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          repository.GNode
+		from           string
+		to             string
+		expectedPath   []string
+		expectedWeight float64
+		expectedError  bool
+	}{
+		{name: "Test weighted DAG", input: weightedGraph(), from: "A", to: "F", expectedPath: []string{"A", "B", "F"}, expectedWeight: 3},
+		{name: "Test from root", input: weightedGraph(), to: "E", expectedPath: []string{"A", "C", "E"}, expectedWeight: 5},
+		{name: "Test duplicate names", input: duplicateNames(), to: "L", expectedPath: []string{"A", "X", "L"}, expectedWeight: 11},
+		{name: "Test unweighted edges count one", input: exampleGraph(), to: "J", expectedPath: []string{"A", "D", "J"}, expectedWeight: 2},
+		{name: "Test same node", input: exampleGraph(), from: "C", to: "C", expectedPath: []string{"C"}, expectedWeight: 0},
+		{name: "Test unreachable node", input: exampleGraph(), from: "B", to: "J", expectedError: true},
+		{name: "Test unknown node", input: exampleGraph(), from: "X", to: "J", expectedError: true},
+		{name: "Test empty graph", input: nil, to: "J", expectedError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, weight, err := ShortestPath(tc.input, tc.from, tc.to)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Expected error %v, but got %v", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if fmt.Sprint(names(path)) != fmt.Sprint(tc.expectedPath) || weight != tc.expectedWeight {
+				t.Errorf("Expected %v weighing %v, but got %v weighing %v", tc.expectedPath, tc.expectedWeight, names(path), weight)
+			}
+		})
+	}
+}
+
+func TestCriticalPath(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          repository.GNode
+		from           string
+		expectedPath   []string
+		expectedWeight float64
+	}{
+		{name: "Test weighted DAG", input: weightedGraph(), expectedPath: []string{"A", "D", "F"}, expectedWeight: 7},
+		{name: "Test from inner node", input: weightedGraph(), from: "C", expectedPath: []string{"C", "E", "F"}, expectedWeight: 5},
+		{name: "Test first of equal paths wins", input: exampleGraph(), expectedPath: []string{"A", "B", "E"}, expectedWeight: 2},
+		{name: "Test leaf", input: exampleGraph(), from: "J", expectedPath: []string{"J"}, expectedWeight: 0},
+		{name: "Test duplicate names", input: duplicateNames(), expectedPath: []string{"A", "X", "L"}, expectedWeight: 11},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, weight, err := CriticalPath(tc.input, tc.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(names(path)) != fmt.Sprint(tc.expectedPath) || weight != tc.expectedWeight {
+				t.Errorf("Expected %v weighing %v, but got %v weighing %v", tc.expectedPath, tc.expectedWeight, names(path), weight)
+			}
+		})
+	}
+}
+
+// 100 diamonds have 2^100 paths, a DAG loaded by UploadGraph is solved once per node.
+func TestCriticalPathHugeDAG(t *testing.T) {
+	path, weight, err := CriticalPath(diamonds(t, 100), "")
+	if err != nil || len(path) != 201 || weight != 200 || path[200].GetName() != "bottom" {
+		t.Errorf("Expected 201 nodes down to bottom weighing 200, but got %d nodes weighing %v and %v", len(path), weight, err)
+	}
+}
+
+func TestUploadWeights(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "graph.json")
+	content := `{"name": "A", "children": [
+		{"name": "B", "weight": 2.5, "attributes": {"owner": "team-a", "duration": 3}},
+		{"name": "C", "children": []}
+	]}`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	graph, err := UploadJson(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := graph.GetChildren()[0].(repository.MyNode)
+	if b.GetWeight() != 2.5 || b.GetAttributes()["owner"] != "team-a" || b.GetAttributes()["duration"] != 3.0 {
+		t.Errorf("Expected weight and attributes of B, but got %v and %v", b.GetWeight(), b.GetAttributes())
+	}
+	if c := graph.GetChildren()[1].(repository.MyNode); c.GetWeight() != 1 {
+		t.Errorf("Expected default weight 1, but got %v", c.GetWeight())
+	}
+
+	if err := os.WriteFile(file, []byte(`{"name": "A", "weight": "heavy"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UploadJson(file); err == nil {
+		t.Errorf("Expected error for weight which is not a number")
+	}
+}
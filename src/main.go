@@ -1,31 +1,148 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"time"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
 
 	"github.com/landrisek/cisco/src/controller"
+	"github.com/landrisek/cisco/src/repository"
 )
 
 func main() {
 	// Define command line flags
 	walkGraph := flag.Bool("walk-graph", false, "Walk the graph")
 	pathsGraph := flag.Bool("paths", false, "Find all paths in graph")
+	statsGraph := flag.Bool("stats", false, "Print statistics of paths in graph without listing them")
+	shortestPath := flag.Bool("shortest-path", false, "Find the path from -from (root by default) to -to with minimal sum of edge weights")
+	criticalPath := flag.Bool("critical-path", false, "Find the path from -from (root by default) to a leaf with maximal sum of edge weights")
 	restAPI := flag.Bool("rest-api", false, "Run server with rest API for tags")
 	countWords := flag.Bool("count-words", false, "Count words in input file")
+	from := flag.String("from", "", "With -paths, -shortest-path or -critical-path, start paths in the node with this name instead of the root")
+	to := flag.String("to", "", "With -paths and -from, print the path from one node to the other through their lowest common ancestor, with -shortest-path the node to reach")
+	leafPattern := flag.String("leaf-pattern", "", "With -paths, only paths ending in nodes with names matching this regular expression")
+	minDepth := flag.Int("min-depth", 0, "With -paths, only paths with at least this many edges")
+	maxDepth := flag.Int("max-depth", 0, "With -paths, end paths at this many edges, 0 is unbounded")
+	queryGraph := flag.String("query", "", "Print paths of nodes of the graph selected by the query, e.g. -query '//C/*[leaf and name!=H]'")
+	diffTrees := flag.Bool("diff", false, "Print changes between two tag files given as arguments, e.g. -diff a.json b.json")
+	mergeTrees := flag.Bool("merge", false, "Merge changes of two tag files since their base, -merge base.json ours.json theirs.json prints the merged tags and exits with 1 on conflicts")
+	graphFile := flag.String("graph", "", "With -walk-graph, -paths and -stats, read this file as a directed graph whose nodes may have more parents, by their ids")
+	topoSort := flag.Bool("toposort", false, "Print nodes of the directed graph (-graph, input_graph.json by default) with parents before children")
+	components := flag.Bool("scc", false, "Print strongly connected components of the directed graph (-graph, input_graph.json by default)")
+	parallelThreshold := flag.Int("parallel-threshold", 0, "Walk graph and find paths in parallel for subtrees of at least this many nodes, 0 is sequential")
+
+	logFormat := flag.String("log-format", envOr("TAGS_LOG_FORMAT", "logfmt"), "Format of logs, json or logfmt (TAGS_LOG_FORMAT)")
+	logLevel := flag.String("log-level", envOr("TAGS_LOG_LEVEL", "info"), "Lowest level logged: debug, info, warn or error (TAGS_LOG_LEVEL)")
+
+	// Settings of rest API, defaults can be also provided by TAGS_* environment variables
+	config, err := controller.ConfigFromEnv(controller.DefaultConfig())
+	exitOn(err, "Error reading environment")
+	flag.StringVar(&config.Host, "host", config.Host, "Host the rest API binds to (TAGS_HOST)")
+	flag.IntVar(&config.Port, "port", config.Port, "Port the rest API listens on (TAGS_PORT)")
+	flag.StringVar(&config.CertFile, "tls-cert", config.CertFile, "Certificate file enabling TLS (TAGS_TLS_CERT)")
+	flag.StringVar(&config.KeyFile, "tls-key", config.KeyFile, "Key file enabling TLS (TAGS_TLS_KEY)")
+	flag.StringVar(&config.ClientCAFile, "tls-client-ca", config.ClientCAFile, "CA bundle enabling mutual TLS (TAGS_TLS_CLIENT_CA)")
+	flag.BoolVar(&config.RequireClientCert, "tls-require-client-cert", config.RequireClientCert, "Reject clients without certificate (TAGS_TLS_REQUIRE_CLIENT_CERT)")
+	flag.DurationVar(&config.ShutdownDelay, "shutdown-delay", config.ShutdownDelay, "How long to serve after reporting not ready on shutdown (TAGS_SHUTDOWN_DELAY)")
+	flag.DurationVar(&config.DrainTimeout, "drain-timeout", config.DrainTimeout, "How long requests may finish on shutdown before canceled (TAGS_DRAIN_TIMEOUT)")
+	flag.StringVar(&config.TraceExporter, "trace-exporter", config.TraceExporter, "Export traces to stdout or otlp, empty disables tracing (TAGS_TRACE_EXPORTER)")
+	flag.StringVar(&config.OTLPEndpoint, "otlp-endpoint", config.OTLPEndpoint, "OpenTelemetry collector base URL for otlp exporter (TAGS_OTLP_ENDPOINT)")
+	flag.Func("ip-quota", "Requests per second and burst per client IP as rate:burst, 0:1 disables (TAGS_IP_QUOTA)", func(value string) (err error) {
+		config.IPQuota, err = controller.ParseQuota(value)
+		return err
+	})
+	flag.Func("token-quota", "Default requests per second and burst per token as rate:burst (TAGS_TOKEN_QUOTA)", func(value string) (err error) {
+		config.TokenQuota, err = controller.ParseQuota(value)
+		return err
+	})
+	flag.Func("token-quotas", "Comma separated token=rate:burst quotas of particular tokens (TAGS_TOKEN_QUOTAS)", func(value string) (err error) {
+		config.TokenQuotas, err = controller.ParseQuotas(value)
+		return err
+	})
+	flag.BoolVar(&config.TrustForwardedFor, "trust-forwarded-for", config.TrustForwardedFor, "Take client IP from X-Forwarded-For (TAGS_TRUST_FORWARDED_FOR)")
+	flag.IntVar(&config.Search.Workers, "search-workers", config.Search.Workers, "Goroutines searching tags, shared by all requests (TAGS_SEARCH_WORKERS)")
+	flag.IntVar(&config.Search.QueueSize, "search-queue", config.Search.QueueSize, "Search tasks waiting for a worker, beyond it callers search themselves (TAGS_SEARCH_QUEUE)")
+	flag.IntVar(&config.Search.ParallelThreshold, "search-threshold", config.Search.ParallelThreshold, "Minimal number of children searched in parallel (TAGS_SEARCH_THRESHOLD)")
+	flag.IntVar(&config.MaxConcurrentSearches, "max-concurrent-searches", config.MaxConcurrentSearches, "Cap of tag searches running at once, 0 is unlimited (TAGS_MAX_CONCURRENT_SEARCHES)")
+	identities := flag.String("tls-identities", "", "Comma separated subject=identity pairs of client certificates (TAGS_TLS_IDENTITIES)")
 
 	// Parse command line flags
 	flag.Parse()
+	logger, err := controller.NewLogger(os.Stderr, *logFormat, *logLevel)
+	exitOn(err, "Error configuring logger")
+	controller.SetLogger(logger)
+	if *identities != "" {
+		config.ClientIdentities, err = controller.ParseIdentities(*identities)
+		exitOn(err, "Error parsing -tls-identities")
+	}
+
+	// Handle "walk-graph" and "paths" flags on a directed graph
+	if *graphFile != "" && (*walkGraph || *pathsGraph) {
+		graph, err := controller.UploadGraph(*graphFile)
+		exitOn(err, "Error uploading graph")
+		if *walkGraph {
+			for _, node := range controller.WalkDirected(graph) {
+				fmt.Println(node.GetName())
+			}
+		}
+		if *pathsGraph {
+			fmt.Print("paths = (")
+			for _, path := range controller.PathsDirected(graph) {
+				fmt.Print(" ")
+				printPath(path)
+			}
+			fmt.Print(" )")
+		}
+	}
+
+	// Handle "toposort" and "scc" flags
+	if *topoSort || *components {
+		filename := *graphFile
+		if filename == "" {
+			filename = "input_graph.json"
+		}
+		graph, err := controller.UploadGraph(filename)
+		exitOn(err, "Error uploading graph")
+		if *topoSort {
+			sorted, err := controller.TopologicalSort(graph)
+			exitOn(err, "Error sorting graph")
+			for _, node := range sorted {
+				fmt.Println(node.GetName())
+			}
+		}
+		if *components {
+			for _, component := range controller.StronglyConnectedComponents(graph) {
+				path := make([]repository.GNode, len(component))
+				for i, node := range component {
+					path[i] = node
+				}
+				printPath(path)
+				fmt.Println()
+			}
+		}
+	}
 
 	// Handle "walk-graph" flag
-	if *walkGraph {
+	if *walkGraph && *graphFile == "" {
 		// Call UploadJson function to read the input JSON and create the graph
 		graph, err := controller.UploadJson("input_graph.json")
-		controller.Log(err, "Error uploading JSON")
+		exitOn(err, "Error uploading JSON")
 
 		// Call WalkGraph function to traverse the graph and get all nodes
-		nodes := controller.WalkGraph(graph)
+		var nodes []repository.GNode
+		if *parallelThreshold > 0 {
+			pool := repository.NewPool(runtime.NumCPU(), 64*runtime.NumCPU())
+			nodes, err = controller.WalkGraphParallel(context.Background(), graph, pool, *parallelThreshold)
+			exitOn(err, "Error walking graph")
+			pool.Close()
+		} else {
+			nodes = controller.WalkGraph(graph)
+		}
 
 		// Print all nodes
 		for _, node := range nodes {
@@ -34,43 +151,214 @@ func main() {
 	}
 
 	// Handle "paths" flag
-	if *pathsGraph {
+	if *pathsGraph && *graphFile == "" {
+		if *to != "" && *from == "" {
+			exitOn(fmt.Errorf("-to needs -from, the node the path starts at"), "Error finding path")
+		}
 		// Call UploadJson function to read the input JSON and create the graph
 		graph, err := controller.UploadJson("input_graph.json")
-		controller.Log(err, "Error uploading JSON")
+		exitOn(err, "Error uploading JSON")
 
 		// Call WalkGraph function to traverse the graph and get all paths
-		paths := controller.Paths(graph)
+		var paths [][]repository.GNode
+		switch {
+		case *to != "":
+			path, err := controller.PathBetween(graph, *from, *to)
+			exitOn(err, "Error finding path")
+			paths = [][]repository.GNode{path}
+		case *from != "" || *leafPattern != "" || *minDepth > 0 || *maxDepth > 0:
+			query := controller.PathQuery{From: *from, MinDepth: *minDepth, MaxDepth: *maxDepth}
+			if *leafPattern != "" {
+				pattern, err := regexp.Compile(*leafPattern)
+				exitOn(err, "Error parsing -leaf-pattern")
+				query.Match = func(node repository.GNode) bool {
+					return pattern.MatchString(node.GetName())
+				}
+			}
+			paths, err = controller.QueryPaths(graph, query)
+			exitOn(err, "Error finding paths")
+		case *parallelThreshold > 0:
+			pool := repository.NewPool(runtime.NumCPU(), 64*runtime.NumCPU())
+			paths, err = controller.PathsParallel(context.Background(), graph, pool, *parallelThreshold)
+			exitOn(err, "Error finding paths")
+			pool.Close()
+		default:
+			paths = controller.Paths(graph)
+		}
 		// Print the paths in the desired format
-		fmt.Print("paths(A) = (")
-		for _, path := range paths {
-			fmt.Print(" (")
-			for i, node := range path {
-				fmt.Print(node.GetName())
-				if i != len(path)-1 {
-					fmt.Print(" ")
+		if *to != "" {
+			fmt.Printf("path(%s, %s) = ", *from, *to)
+			printPath(paths[0])
+		} else {
+			start := graph.GetName()
+			if *from != "" {
+				start = *from
+			}
+			fmt.Printf("paths(%s) = (", start)
+			for _, path := range paths {
+				fmt.Print(" ")
+				printPath(path)
+			}
+			fmt.Print(" )")
+		}
+	}
+
+	// Handle "shortest-path" and "critical-path" flags
+	if *shortestPath || *criticalPath {
+		graph, err := controller.UploadJson("input_graph.json")
+		exitOn(err, "Error uploading JSON")
+
+		start := graph.GetName()
+		if *from != "" {
+			start = *from
+		}
+		if *shortestPath {
+			path, weight, err := controller.ShortestPath(graph, *from, *to)
+			exitOn(err, "Error finding shortest path")
+			fmt.Printf("shortest(%s, %s) = ", start, *to)
+			printPath(path)
+			fmt.Printf(" weight %g\n", weight)
+		}
+		if *criticalPath {
+			path, weight, err := controller.CriticalPath(graph, *from)
+			exitOn(err, "Error finding critical path")
+			fmt.Printf("critical(%s) = ", start)
+			printPath(path)
+			fmt.Printf(" weight %g\n", weight)
+		}
+	}
+
+	// Handle "stats" flag
+	if *statsGraph {
+		var roots []repository.GNode
+		if *graphFile != "" {
+			// HINT: nodes of a graph have identity, so nodes shared by more parents are computed once
+			graph, err := controller.UploadGraph(*graphFile)
+			exitOn(err, "Error uploading graph")
+			_, err = controller.TopologicalSort(graph)
+			exitOn(err, "Error computing statistics")
+			for _, root := range graph.Roots() {
+				roots = append(roots, root)
+			}
+		} else {
+			graph, err := controller.UploadJson("input_graph.json")
+			exitOn(err, "Error uploading JSON")
+			roots = []repository.GNode{graph}
+		}
+
+		for _, graph := range roots {
+			if len(roots) > 1 {
+				fmt.Printf("root: %s\n", graph.GetName())
+			}
+			stats := controller.PathStatistics(graph)
+			fmt.Printf("nodes: %d\n", stats.Nodes)
+			fmt.Printf("paths: %d\n", stats.Paths)
+			fmt.Printf("path length: min %d, max %d, average %.2f\n", stats.MinLength, stats.MaxLength, stats.AverageLength)
+			fmt.Println("paths by length:")
+			for length, count := range stats.LengthHistogram {
+				if count > 0 {
+					fmt.Printf("  %d: %d\n", length, count)
 				}
 			}
-			fmt.Print(")")
+			fmt.Println("leaves per subtree:")
+			for _, subtree := range controller.LeafCounts(graph) {
+				fmt.Printf("  %s%s: %d\n", strings.Repeat("  ", subtree.Depth), subtree.Name, subtree.Leaves)
+			}
+		}
+	}
+
+	// Handle "query" flag
+	if *queryGraph != "" {
+		selector, err := controller.ParseSelector(*queryGraph)
+		exitOn(err, "Error parsing query")
+		graph, err := controller.UploadJson("input_graph.json")
+		exitOn(err, "Error uploading JSON")
+		for _, match := range selector.Select(graph) {
+			fmt.Println(strings.Join(match.Path, "/"))
+		}
+	}
+
+	// Handle "diff" flag
+	if *diffTrees {
+		if flag.NArg() != 2 {
+			exitOn(fmt.Errorf("expected two files, got %d", flag.NArg()), "Error comparing tags")
+		}
+		before, err := controller.UploadJson(flag.Arg(0))
+		exitOn(err, "Error uploading JSON")
+		after, err := controller.UploadJson(flag.Arg(1))
+		exitOn(err, "Error uploading JSON")
+		for _, change := range controller.Diff(before, after) {
+			fmt.Println(change)
+		}
+	}
+
+	// Handle "merge" flag
+	if *mergeTrees {
+		if flag.NArg() != 3 {
+			exitOn(fmt.Errorf("expected base, ours and theirs files, got %d", flag.NArg()), "Error merging tags")
+		}
+		var versions []repository.GNode
+		for _, filename := range flag.Args() {
+			version, err := controller.UploadJson(filename)
+			exitOn(err, "Error uploading JSON")
+			versions = append(versions, version)
+		}
+		merged, conflicts, err := controller.Merge(versions[0], versions[1], versions[2])
+		exitOn(err, "Error merging tags")
+		output, err := json.MarshalIndent(&merged, "", "  ")
+		exitOn(err, "Error encoding merged tags")
+		fmt.Println(string(output))
+		for _, conflict := range conflicts {
+			fmt.Fprintln(os.Stderr, conflict)
+		}
+		if len(conflicts) > 0 {
+			os.Exit(1)
 		}
-		fmt.Print(" )")
 	}
 
 	// Handle "paths" flag
 	if *restAPI {
-		defer func() {
-			fmt.Printf("container died on %v"+"\n", time.Now())
-		}()
-		fmt.Printf("container started on %v"+"\n", time.Now())
+		logger.Info("Container started")
 		// Call UploadJson function to read the input JSON and create the graph
-		tags, err := controller.UploadJson("input_tags.json")
-		controller.Log(err, "Error uploading JSON")
-		controller.RestAPI(tags)
+		if config.TagsFile == "" {
+			config.TagsFile = "input_tags.json"
+		}
+		tags, err := controller.UploadJson(config.TagsFile)
+		exitOn(err, "Error uploading JSON")
+		exitOn(controller.RestAPI(tags, config), "Error serving rest API")
+		logger.Info("Container stopped")
 	}
 
 	// Handle "paths" flag
 	if *countWords {
 		err := controller.CountWords("input_words.txt")
-		controller.Log(err, "Error on counting words")
+		exitOn(err, "Error on counting words")
+	}
+}
+
+// printPath prints names of nodes of the path as (A B E).
+func printPath(path []repository.GNode) {
+	fmt.Print("(")
+	for i, node := range path {
+		fmt.Print(node.GetName())
+		if i != len(path)-1 {
+			fmt.Print(" ")
+		}
+	}
+	fmt.Print(")")
+}
+
+// exitOn logs the error and exits the process with failure, nil error is ignored.
+func exitOn(err error, msg string) {
+	if controller.Log(err, msg) {
+		os.Exit(1)
+	}
+}
+
+// envOr returns the value of the environment variable or fallback when it is not set.
+func envOr(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
 	}
+	return fallback
 }
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// PanicError is the error of a task which panicked, Value is what it panicked with.
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+// Future is the result of a task submitted to a pool.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Done is closed once the result is available.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait returns the result of the task, or the error of ctx when it is done sooner.
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Submit runs the task on the pool and returns its future. When the task can not be scheduled,
+// the future is completed at once with the error of Schedule.
+// HINT: Go does not allow type parameters on methods, so this is a function taking the pool.
+func Submit[T any](ctx context.Context, pool *Pool, task func(context.Context) (T, error)) *Future[T] {
+	future := &Future[T]{done: make(chan struct{})}
+	err := pool.Schedule(ctx, func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				future.err = &PanicError{Value: recovered}
+				close(future.done)
+				// HINT: panic again so the pool counts it and calls its PanicHandler
+				panic(recovered)
+			}
+		}()
+		future.value, future.err = task(ctx)
+		close(future.done)
+	})
+	if err != nil {
+		future.err = err
+		close(future.done)
+	}
+	return future
+}
+
+// Group runs tasks on a pool with error group semantics: the first failure cancels the context
+// of all tasks of the group and it is returned by Wait. A group is used once, the pool is shared.
+// Tasks wait in a queue of the group, the pool is handed only a reference to it. That way Wait can
+// run tasks of its own group, never tasks of other groups sharing the pool.
+type Group struct {
+	pool   *Pool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+	mutex  sync.Mutex
+	queue  []func()
+	// wake tells Wait that a task was queued
+	wake chan struct{}
+}
+
+// NewGroup creates a group of tasks and the context they run with, canceled with the first failure.
+func NewGroup(ctx context.Context, pool *Pool) (*Group, context.Context) {
+	group := &Group{pool: pool, wake: make(chan struct{}, 1)}
+	group.ctx, group.cancel = context.WithCancel(ctx)
+	return group, group.ctx
+}
+
+// Go runs the task on the pool. Tasks may call Go themselves, e.g. for children of a node,
+// as a full queue makes the task run in the caller instead of blocking it.
+// A task not started yet when the group is canceled is skipped.
+func (g *Group) Go(task func(context.Context) error) {
+	g.wg.Add(1)
+	g.push(func() {
+		defer g.wg.Done()
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				g.fail(&PanicError{Value: recovered})
+				panic(recovered)
+			}
+		}()
+		if err := g.ctx.Err(); err != nil {
+			g.fail(err)
+			return
+		}
+		if err := task(g.ctx); err != nil {
+			g.fail(err)
+		}
+	})
+	// HINT: the pool runs whichever task of the group is first in the queue, the one pushed above may be run by Wait already
+	err := g.pool.Schedule(g.ctx, func() {
+		if task := g.pop(); task != nil {
+			task()
+		}
+	})
+	if errors.Is(err, ErrPoolClosed) {
+		// HINT: a closed pool only loses its workers, the task runs in the caller as with a full queue
+		if task := g.pop(); task != nil {
+			atomic.AddInt64(&g.pool.inline, 1)
+			g.pool.run(task)
+		}
+	} else if err != nil {
+		// the task stays in the queue, Wait skips it as the failure cancels the group
+		g.fail(err)
+	}
+}
+
+func (g *Group) push(task func()) {
+	g.mutex.Lock()
+	g.queue = append(g.queue, task)
+	g.mutex.Unlock()
+	select {
+	case g.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes the first task from the queue of the group, nil when it is empty.
+func (g *Group) pop() func() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if len(g.queue) == 0 {
+		return nil
+	}
+	task := g.queue[0]
+	g.queue[0] = nil
+	g.queue = g.queue[1:]
+	return task
+}
+
+func (g *Group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Wait blocks until all tasks of the group finished and returns the first failure.
+// While waiting it runs queued tasks of the group, so a task waiting for its own group,
+// e.g. Map called from Map, never holds a worker its subtasks need. Tasks of other groups
+// are left to workers, so the latency of Wait depends only on the work of its group.
+func (g *Group) Wait() error {
+	finished := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(finished)
+	}()
+	for {
+		for task := g.pop(); task != nil; task = g.pop() {
+			atomic.AddInt64(&g.pool.inline, 1)
+			g.pool.run(task)
+		}
+		select {
+		case <-finished:
+			g.cancel()
+			return g.err
+		case <-g.wake:
+		}
+	}
+}
+
+// Map applies fn to all items on the pool and returns the results in order of items.
+// The first error cancels the remaining calls and it is returned instead of results.
+func Map[T any, R any](ctx context.Context, pool *Pool, items []T, fn func(context.Context, T) (R, error)) ([]R, error) {
+	results := make([]R, len(items))
+	group, _ := NewGroup(ctx, pool)
+	for i := range items {
+		i := i
+		group.Go(func(ctx context.Context) error {
+			result, err := fn(ctx, items[i])
+			results[i] = result
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ForEach calls fn for all items on the pool, the first error cancels the remaining calls and it is returned.
+func ForEach[T any](ctx context.Context, pool *Pool, items []T, fn func(context.Context, T) error) error {
+	group, _ := NewGroup(ctx, pool)
+	for i := range items {
+		item := items[i]
+		group.Go(func(ctx context.Context) error {
+			return fn(ctx, item)
+		})
+	}
+	return group.Wait()
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"fmt"
+)
+
+// Graph is a directed graph of nodes addressed by id. Unlike a tree of MyNode, a node may have
+// more parents, the graph may have more roots and even cycles. Nodes and edges keep the order
+// they were added in, so everything computed over the graph is deterministic.
+type Graph struct {
+	nodes map[string]*GraphNode
+	order []*GraphNode
+}
+
+// GraphNode is a node of Graph. It implements GNode, so a graph without cycles can be used
+// wherever a tree is expected, shared nodes are then reached once per parent.
+type GraphNode struct {
+	id       string
+	name     string
+	children []GNode
+	parents  []*GraphNode
+	// referenced is true while the node is known only from a reference, its name is then its id
+	referenced bool
+}
+
+func NewGraph() *Graph {
+	return &Graph{nodes: make(map[string]*GraphNode)}
+}
+
+// AddNode adds a node with the id and returns it. Adding an existing id returns the existing node,
+// it is an error only when the names differ. A node added by AddReference takes the name.
+func (g *Graph) AddNode(id string, name string) (*GraphNode, error) {
+	if id == "" {
+		return nil, fmt.Errorf("node %s has no id", name)
+	}
+	if node, ok := g.nodes[id]; ok {
+		if node.referenced {
+			node.name = name
+			node.referenced = false
+		}
+		if node.name != name {
+			return nil, fmt.Errorf("node %s is already named %s, not %s", id, node.name, name)
+		}
+		return node, nil
+	}
+	node := &GraphNode{id: id, name: name}
+	g.nodes[id] = node
+	g.order = append(g.order, node)
+	return node, nil
+}
+
+// AddReference returns the node with the id, adding it when it was not added yet. The node is named
+// by its id until AddNode defines it, so a node may be referred to before it is defined.
+func (g *Graph) AddReference(id string) (*GraphNode, error) {
+	if node, ok := g.nodes[id]; ok {
+		return node, nil
+	}
+	node, err := g.AddNode(id, id)
+	if err != nil {
+		return nil, err
+	}
+	node.referenced = true
+	return node, nil
+}
+
+// AddEdge adds an edge from parent to child, both have to exist. An edge added twice is kept once.
+func (g *Graph) AddEdge(parent string, child string) error {
+	from, ok := g.nodes[parent]
+	if !ok {
+		return fmt.Errorf("node %s not found", parent)
+	}
+	to, ok := g.nodes[child]
+	if !ok {
+		return fmt.Errorf("node %s not found", child)
+	}
+	for _, existing := range from.children {
+		if existing.(*GraphNode) == to {
+			return nil
+		}
+	}
+	from.children = append(from.children, to)
+	to.parents = append(to.parents, from)
+	return nil
+}
+
+// Node returns the node with the id.
+func (g *Graph) Node(id string) (*GraphNode, bool) {
+	node, ok := g.nodes[id]
+	return node, ok
+}
+
+// Nodes returns all nodes in the order they were added.
+func (g *Graph) Nodes() []*GraphNode {
+	return g.order
+}
+
+// Roots returns nodes without parents in the order they were added.
+func (g *Graph) Roots() []*GraphNode {
+	var roots []*GraphNode
+	for _, node := range g.order {
+		if len(node.parents) == 0 {
+			roots = append(roots, node)
+		}
+	}
+	return roots
+}
+
+func (n *GraphNode) ID() string {
+	return n.id
+}
+
+func (n *GraphNode) GetName() string {
+	return n.name
+}
+
+// GetChildren returns children in the order edges were added, all of them are *GraphNode.
+func (n *GraphNode) GetChildren() []GNode {
+	return n.children
+}
+
+// Parents returns parents in the order edges were added.
+func (n *GraphNode) Parents() []*GraphNode {
+	return n.parents
+}
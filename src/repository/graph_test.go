@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	graph := NewGraph()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if _, err := graph.AddNode(id, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edges := [][2]string{{"a", "c"}, {"b", "c"}, {"c", "d"}, {"a", "c"}}
+	for _, edge := range edges {
+		if err := graph.AddEdge(edge[0], edge[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		actual   []*GraphNode
+		expected []string
+	}{
+		{name: "Test nodes", actual: graph.Nodes(), expected: []string{"a", "b", "c", "d"}},
+		{name: "Test roots", actual: graph.Roots(), expected: []string{"a", "b"}},
+		{name: "Test more parents", actual: graph.nodes["c"].Parents(), expected: []string{"a", "b"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if len(tc.actual) != len(tc.expected) {
+				t.Fatalf("Expected %v, but got %d nodes", tc.expected, len(tc.actual))
+			}
+			for i, node := range tc.actual {
+				if node.ID() != tc.expected[i] {
+					t.Errorf("Expected %s at %d, but got %s", tc.expected[i], i, node.ID())
+				}
+			}
+		})
+	}
+	if children := graph.nodes["a"].GetChildren(); len(children) != 1 {
+		t.Errorf("Expected edge added twice to be kept once, but got %d children", len(children))
+	}
+
+	if _, err := graph.AddNode("a", "other"); err == nil {
+		t.Error("Expected error for id with different name")
+	}
+	if node, err := graph.AddReference("e"); err != nil || node.GetName() != "e" {
+		t.Errorf("Expected reference named by its id, but got %v, %v", node, err)
+	}
+	if node, err := graph.AddNode("e", "E"); err != nil || node.GetName() != "E" {
+		t.Errorf("Expected referenced node to take name E, but got %v, %v", node, err)
+	}
+	if _, err := graph.AddNode("e", "other"); err == nil {
+		t.Error("Expected error for defined node with different name")
+	}
+	if node, err := graph.AddReference("a"); err != nil || node.GetName() != "a" {
+		t.Errorf("Expected reference to return node a, but got %v, %v", node, err)
+	}
+	if _, err := graph.AddNode("", "empty"); err == nil {
+		t.Error("Expected error for empty id")
+	}
+	if err := graph.AddEdge("a", "x"); err == nil {
+		t.Error("Expected error for edge to unknown node")
+	}
+}
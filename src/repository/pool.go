@@ -1,37 +1,142 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 )
 
+// ErrPoolClosed is returned by Schedule once the pool is closed.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// Pool is a long-lived set of workers shared by all searches of the process. Its queue is bounded,
+// a task not fitting into the queue runs in the goroutine scheduling it. That way a full pool only
+// slows the caller down and workers scheduling further tasks can never deadlock on each other.
 type Pool struct {
-	taskChan chan func()
-	wg       sync.WaitGroup
+	// PanicHandler is called with the value of a panic recovered in a task, panics are dropped when nil.
+	PanicHandler func(any)
+	taskChan     chan func()
+	workers      int
+	mutex        sync.RWMutex
+	closed       bool
+	stopped      sync.WaitGroup
+	queued       int64
+	active       int64
+	executed     int64
+	inline       int64
+	panics       int64
+}
+
+// PoolStats is a snapshot of the pool for monitoring.
+type PoolStats struct {
+	Workers int
+	// Queued tasks wait for a worker, Active ones are being run by workers.
+	Queued int64
+	Active int64
+	// Executed counts tasks finished by workers, Inline those run by the caller as the queue was full
+	// or by a goroutine waiting for its group.
+	// HINT: a worker may find the task of a group already run by Wait, it counts in Executed too
+	Executed int64
+	Inline   int64
+	Panics   int64
 }
 
-func NewPool(capacity int) *Pool {
+// NewPool starts workers goroutines serving a queue of queueSize tasks.
+func NewPool(workers int, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
 	pool := &Pool{
-		taskChan: make(chan func(), capacity),
+		taskChan: make(chan func(), queueSize),
+		workers:  workers,
 	}
-	for i := 0; i < capacity; i++ {
+	pool.stopped.Add(workers)
+	for i := 0; i < workers; i++ {
 		go pool.worker()
 	}
 	return pool
 }
 
-func (p *Pool) Schedule(task func()) {
-	p.wg.Add(1)
-	p.taskChan <- task
+// Schedule hands the task to a worker. When the queue is full, the task is run before Schedule returns.
+// Nothing is run and an error is returned when ctx is already done or the pool is closed.
+func (p *Pool) Schedule(ctx context.Context, task func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.mutex.RLock()
+	if p.closed {
+		p.mutex.RUnlock()
+		return ErrPoolClosed
+	}
+	atomic.AddInt64(&p.queued, 1)
+	select {
+	case p.taskChan <- task:
+		p.mutex.RUnlock()
+		return nil
+	default:
+		atomic.AddInt64(&p.queued, -1)
+		p.mutex.RUnlock()
+	}
+	// HINT: backpressure, the caller does the work itself instead of waiting for a free slot
+	atomic.AddInt64(&p.inline, 1)
+	p.run(task)
+	return nil
 }
 
 func (p *Pool) worker() {
+	defer p.stopped.Done()
 	for task := range p.taskChan {
-		task()
-		p.wg.Done()
+		p.runQueued(task)
 	}
 }
 
-func (p *Pool) Wait() {
+// runQueued runs a task taken from the queue by a worker.
+func (p *Pool) runQueued(task func()) {
+	atomic.AddInt64(&p.queued, -1)
+	atomic.AddInt64(&p.active, 1)
+	p.run(task)
+	atomic.AddInt64(&p.active, -1)
+	atomic.AddInt64(&p.executed, 1)
+}
+
+// run executes the task, a panic in it is recovered so it does not take the worker or the process down.
+func (p *Pool) run(task func()) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			atomic.AddInt64(&p.panics, 1)
+			if p.PanicHandler != nil {
+				p.PanicHandler(recovered)
+			}
+		}
+	}()
+	task()
+}
+
+// Stats returns current numbers of the pool.
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Workers:  p.workers,
+		Queued:   atomic.LoadInt64(&p.queued),
+		Active:   atomic.LoadInt64(&p.active),
+		Executed: atomic.LoadInt64(&p.executed),
+		Inline:   atomic.LoadInt64(&p.inline),
+		Panics:   atomic.LoadInt64(&p.panics),
+	}
+}
+
+// Close stops accepting tasks, runs the queued ones and waits for workers to finish. Only first call counts.
+func (p *Pool) Close() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
 	close(p.taskChan)
-	p.wg.Wait()
-}
\ No newline at end of file
+	p.mutex.Unlock()
+	p.stopped.Wait()
+}
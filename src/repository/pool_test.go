@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	pool := NewPool(2, 4)
+	var wg sync.WaitGroup
+	var executed int64
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		err := pool.Schedule(context.Background(), func() {
+			defer wg.Done()
+			atomic.AddInt64(&executed, 1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if executed != 100 {
+		t.Errorf("Expected 100 tasks executed, but got %d", executed)
+	}
+	pool.Close()
+	stats := pool.Stats()
+	if stats.Workers != 2 || stats.Executed+stats.Inline != 100 || stats.Queued != 0 || stats.Active != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if err := pool.Schedule(context.Background(), func() {}); err != ErrPoolClosed {
+		t.Errorf("Expected ErrPoolClosed, but got %v", err)
+	}
+	pool.Close()
+}
+
+func TestPoolInlineWhenFull(t *testing.T) {
+	pool := NewPool(1, 1)
+	defer pool.Close()
+	block := make(chan struct{})
+	started := make(chan struct{})
+	pool.Schedule(context.Background(), func() {
+		close(started)
+		<-block
+	})
+	<-started
+	// worker is busy, this one fills the queue
+	pool.Schedule(context.Background(), func() {})
+	// queue is full, this one has to run in our goroutine
+	ran := false
+	pool.Schedule(context.Background(), func() { ran = true })
+	if !ran {
+		t.Errorf("Expected task run inline when queue is full")
+	}
+	if stats := pool.Stats(); stats.Inline != 1 || stats.Queued != 1 || stats.Active != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	close(block)
+}
+
+func TestPoolCanceledContext(t *testing.T) {
+	pool := NewPool(1, 1)
+	defer pool.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	if err := pool.Schedule(ctx, func() { ran = true }); err != context.Canceled || ran {
+		t.Errorf("Expected canceled task not to run, but got %v and ran %v", err, ran)
+	}
+}
+
+func TestPoolRecoversPanic(t *testing.T) {
+	pool := NewPool(1, 1)
+	recovered := make(chan any, 1)
+	pool.PanicHandler = func(value any) {
+		recovered <- value
+	}
+	pool.Schedule(context.Background(), func() { panic("boom") })
+	if value := <-recovered; value != "boom" {
+		t.Errorf("Expected panic boom, but got %v", value)
+	}
+	// worker survived the panic
+	done := make(chan struct{})
+	pool.Schedule(context.Background(), func() { close(done) })
+	<-done
+	pool.Close()
+	if stats := pool.Stats(); stats.Panics != 1 {
+		t.Errorf("Expected 1 panic, but got %d", stats.Panics)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	pool := NewPool(2, 2)
+	defer pool.Close()
+	tests := []struct {
+		name          string
+		task          func(context.Context) (int, error)
+		expected      int
+		expectedError string
+	}{
+		{name: "value", task: func(context.Context) (int, error) { return 42, nil }, expected: 42},
+		{name: "error", task: func(context.Context) (int, error) { return 0, errors.New("failed") }, expectedError: "failed"},
+		{name: "panic", task: func(context.Context) (int, error) { panic("boom") }, expectedError: "task panicked: boom"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := Submit(context.Background(), pool, tc.task).Wait(context.Background())
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Errorf("Expected error %q, but got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil || value != tc.expected {
+				t.Errorf("Expected %d, but got %d and %v", tc.expected, value, err)
+			}
+		})
+	}
+
+	// the pool is reusable, unlike the one closing its channel in Wait
+	for i := 0; i < 3; i++ {
+		if value, err := Submit(context.Background(), pool, func(context.Context) (int, error) { return i, nil }).Wait(context.Background()); err != nil || value != i {
+			t.Errorf("Expected %d, but got %d and %v", i, value, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Submit(ctx, pool, tests[0].task).Wait(context.Background()); err != context.Canceled {
+		t.Errorf("Expected canceled submit, but got %v", err)
+	}
+}
+
+func TestMap(t *testing.T) {
+	pool := NewPool(4, 2)
+	defer pool.Close()
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+
+	results, err := Map(context.Background(), pool, items, func(_ context.Context, item int) (string, error) {
+		return strconv.Itoa(item * item), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if result != strconv.Itoa(i*i) {
+			t.Fatalf("Expected results in order of items, but got %s at %d", result, i)
+		}
+	}
+
+	failure := errors.New("odd")
+	_, err = Map(context.Background(), pool, items, func(ctx context.Context, item int) (int, error) {
+		if item == 0 {
+			return 0, failure
+		}
+		// the others wait until the failure cancels them
+		// HINT: the first item fails, as Map may run a task inline before scheduling the later ones
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if err != failure {
+		t.Errorf("Expected first error, but got %v", err)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	pool := NewPool(4, 2)
+	defer pool.Close()
+	var sum int64
+	err := ForEach(context.Background(), pool, []int64{1, 2, 3, 4}, func(_ context.Context, item int64) error {
+		atomic.AddInt64(&sum, item)
+		return nil
+	})
+	if err != nil || sum != 10 {
+		t.Errorf("Expected sum 10, but got %d and %v", sum, err)
+	}
+
+	err = ForEach(context.Background(), pool, []int{1, 2, 3}, func(context.Context, int) error {
+		panic("boom")
+	})
+	var panicError *PanicError
+	if !errors.As(err, &panicError) || panicError.Value != "boom" {
+		t.Errorf("Expected panic error, but got %v", err)
+	}
+}
+
+// Tasks waiting for their own subtasks used to hold the only worker the subtasks needed.
+func TestNestedMap(t *testing.T) {
+	pool := NewPool(1, 4)
+	defer pool.Close()
+	results, err := Map(context.Background(), pool, []int{1, 2, 3}, func(ctx context.Context, item int) (int, error) {
+		nested, err := Map(ctx, pool, []int{item, item, item}, func(_ context.Context, item int) (int, error) {
+			return item, nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		return nested[0] + nested[1] + nested[2], nil
+	})
+	if err != nil || len(results) != 3 || results[0] != 3 || results[2] != 9 {
+		t.Errorf("Unexpected results %v and %v", results, err)
+	}
+}
+
+// Wait used to run any task of the pool, so one request could end up doing the work of others.
+func TestGroupWaitRunsOwnTasks(t *testing.T) {
+	pool := NewPool(1, 4)
+	defer pool.Close()
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	// the only worker is busy, so tasks below stay in the queue
+	if err := pool.Schedule(context.Background(), func() {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	var foreign int64
+	if err := pool.Schedule(context.Background(), func() { atomic.AddInt64(&foreign, 1) }); err != nil {
+		t.Fatal(err)
+	}
+
+	group, _ := NewGroup(context.Background(), pool)
+	var own int64
+	for i := 0; i < 3; i++ {
+		group.Go(func(context.Context) error {
+			atomic.AddInt64(&own, 1)
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil || atomic.LoadInt64(&own) != 3 {
+		t.Errorf("Expected 3 tasks of the group, but got %d and %v", own, err)
+	}
+	if atomic.LoadInt64(&foreign) != 0 {
+		t.Error("Expected Wait not to run tasks of others")
+	}
+}
@@ -1,10 +1,17 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
 	"sync/atomic"
+
+	"github.com/landrisek/cisco/src/tracing"
 )
 
 type GNode interface {
@@ -12,9 +19,20 @@ type GNode interface {
 	GetChildren() []GNode
 }
 
+// Weighted is implemented by nodes knowing the weight of the edge from their parent.
+type Weighted interface {
+	GetWeight() float64
+}
+
+// MyNode is the node built by the loader. Copies of a MyNode share its slice of children,
+// Tree is the immutable node to use when a tree is read and edited at the same time.
 type MyNode struct {
 	name     string  `json:"name"`
 	children []GNode `json:"children"`
+	// weight of the edge from the parent, edges without weight count 1
+	weight     float64
+	weighted   bool
+	attributes map[string]interface{}
 }
 
 // NewNode creates and returns a new instance of MyNode.
@@ -58,13 +76,60 @@ func (n *MyNode) SetChildren(children []GNode) *MyNode {
 	return n
 }
 
-// MarshalJSON is exposing json for rest api server purposes.
-func (n *MyNode) MarshalJSON() ([]byte, error) {
-	type node struct {
-		Name     string   `json:"name"`
-		Children []MyNode `json:"children"`
+// GetWeight returns the weight of the edge from the parent, 1 when none was set.
+func (n MyNode) GetWeight() float64 {
+	if !n.weighted {
+		return 1
 	}
+	return n.weight
+}
 
+func (n *MyNode) SetWeight(weight float64) *MyNode {
+	n.weight, n.weighted = weight, true
+	return n
+}
+
+// GetAttributes returns metadata of the node, e.g. id, description, aliases, translations or owner.
+// The map must not be modified.
+func (n MyNode) GetAttributes() map[string]interface{} {
+	return n.attributes
+}
+
+func (n *MyNode) SetAttributes(attributes map[string]interface{}) *MyNode {
+	n.attributes = attributes
+	return n
+}
+
+// GetAttribute returns the attribute of the node by its key.
+func (n MyNode) GetAttribute(key string) (interface{}, bool) {
+	value, ok := n.attributes[key]
+	return value, ok
+}
+
+// WithChildren returns a copy of the node with other children, the node itself is left as it is.
+func (n MyNode) WithChildren(children []GNode) MyNode {
+	n.children = children
+	return n
+}
+
+// WithName returns a copy of the node with another name, the node itself is left as it is.
+func (n MyNode) WithName(name string) MyNode {
+	n.name = name
+	return n
+}
+
+// WithAttributes returns a copy of the node with other attributes, the node itself is left as it is.
+func (n MyNode) WithAttributes(attributes map[string]interface{}) MyNode {
+	n.attributes = attributes
+	return n
+}
+
+// reservedKeys are keys of the tag itself, attributes with the same key are not marshaled.
+var reservedKeys = map[string]bool{"name": true, "weight": true, "children": true}
+
+// MarshalJSON is exposing json for rest api server purposes.
+// Attributes are written as keys of the tag next to its name, sorted, so the output reads like the input.
+func (n *MyNode) MarshalJSON() ([]byte, error) {
 	var children []MyNode
 	for _, child := range n.children {
 		myNode, ok := child.(MyNode)
@@ -73,79 +138,242 @@ func (n *MyNode) MarshalJSON() ([]byte, error) {
 		}
 		children = append(children, myNode)
 	}
+	return marshalTag(n.name, n.weight, n.weighted, n.attributes, children)
+}
+
+// marshalTag writes a tag as MyNode.MarshalJSON describes, children are written as they marshal themselves.
+func marshalTag(name string, weight float64, weighted bool, attributes map[string]interface{}, children interface{}) ([]byte, error) {
+	// HINT: json.Marshal of a map would sort name among the attributes, so the object is written field by field
+	var buffer bytes.Buffer
+	write := func(key string, value interface{}) error {
+		// HINT: the value is marshaled first, so a failure leaves no dangling separator behind
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%s of tag %s: %w", key, name, err)
+		}
+		if buffer.Len() == 0 {
+			buffer.WriteByte('{')
+		} else {
+			buffer.WriteByte(',')
+		}
+		keyJSON, _ := json.Marshal(key)
+		buffer.Write(keyJSON)
+		buffer.WriteByte(':')
+		buffer.Write(encoded)
+		return nil
+	}
+	if err := write("name", name); err != nil {
+		return nil, err
+	}
+	if weighted {
+		if err := write("weight", weight); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		if !reservedKeys[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := write(key, attributes[key]); err != nil {
+			return nil, err
+		}
+	}
+	if err := write("children", children); err != nil {
+		return nil, err
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// SearchConfig controls how GetSubTags spreads the search over goroutines. It is meant to be set once
+// at startup, as GOMAXPROCS is left for the runtime and the whole process.
+type SearchConfig struct {
+	// Workers is the number of goroutines of the pool searching subtrees in parallel.
+	Workers int
+	// QueueSize bounds tasks waiting for a worker, when the queue is full the searching goroutine
+	// takes the subtree itself.
+	QueueSize int
+	// ParallelThreshold is the minimal number of children of a node to search them in parallel,
+	// smaller nodes are searched in the calling goroutine as scheduling would cost more than it saves.
+	ParallelThreshold int
+}
+
+// DefaultSearchConfig uses one worker per CPU with a queue of 64 tasks per worker and searches
+// children in parallel from 10 of them.
+func DefaultSearchConfig() SearchConfig {
+	return SearchConfig{
+		Workers:           runtime.NumCPU(),
+		QueueSize:         64 * runtime.NumCPU(),
+		ParallelThreshold: 10,
+	}
+}
+
+// Searcher looks up tags with fixed concurrency settings. All its searches share one worker pool.
+type Searcher struct {
+	config SearchConfig
+	pool   *Pool
+}
+
+// NewSearcher creates a searcher and starts workers of its pool, at least one worker is always used.
+func NewSearcher(config SearchConfig) *Searcher {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	return &Searcher{config: config, pool: NewPool(config.Workers, config.QueueSize)}
+}
+
+// Pool returns the worker pool of the searcher, e.g. to read its stats.
+func (s *Searcher) Pool() *Pool {
+	return s.pool
+}
 
-	return json.Marshal(node{
-		Name:     n.name,
-		Children: children,
-	})
+// Close stops workers of the pool, searches started afterwards run without them.
+func (s *Searcher) Close() {
+	s.pool.Close()
 }
 
+// defaultSearcher serves the package functions below. It is created by the first search, so programs
+// importing the package without searching, e.g. CLI modes, do not start its workers.
+var defaultSearcher = sync.OnceValue(func() *Searcher {
+	return NewSearcher(DefaultSearchConfig())
+})
+
 // GetSubTags will return fist occurence of tag.
 // It does not expect tags with duplicite names in data structures.
 func GetSubTags(ctx context.Context, node GNode, tag string) MyNode {
-	result := make(chan MyNode, 1)
-	active := int32(1)
-	done := make(chan struct{})
-	innerCtx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	pool := NewPool(10)
-	defer pool.Wait()
-	go lookupChildrens(ctx, innerCtx, node, tag, result, done, pool, &active)
-
-	select {
-	case <-ctx.Done():
-		return MyNode{}
-	case <-innerCtx.Done():
-		return MyNode{}
-	case res := <-result:
-		return res
-	case <-done:
-		return MyNode{}
-	}
-}
-
-// lookupChildrens performs a recursive search for a specific tag within a node and its children,
-// utilizing parallel processing for improved performance in the hot spot section.
-// It sends matching nodes to the result channel and tracks the number of active goroutines using the active counter.
+	return defaultSearcher().GetSubTags(ctx, node, tag)
+}
+
+// LookupSubTags works as GetSubTags and it also returns how many nodes were visited during the search.
+func LookupSubTags(ctx context.Context, node GNode, tag string) (MyNode, int) {
+	return defaultSearcher().LookupSubTags(ctx, node, tag)
+}
+
+// FindSubTags works as LookupSubTags, but it returns the matching node itself, nil when none matches.
+func FindSubTags(ctx context.Context, node GNode, tag string) (GNode, int) {
+	return defaultSearcher().FindSubTags(ctx, node, tag)
+}
+
+// GetSubTags will return fist occurence of tag using the settings of the searcher.
+func (s *Searcher) GetSubTags(ctx context.Context, node GNode, tag string) MyNode {
+	result, _ := s.LookupSubTags(ctx, node, tag)
+	return result
+}
+
+// LookupSubTags works as GetSubTags and it also returns how many nodes were visited during the search.
+func (s *Searcher) LookupSubTags(ctx context.Context, node GNode, tag string) (MyNode, int) {
+	found, visited := s.FindSubTags(ctx, node, tag)
+	if found == nil {
+		return MyNode{}, visited
+	}
+	// HINT: other nodes than MyNode, e.g. Tree, are converted with their whole subtree
+	return toMyNode(found), visited
+}
+
+// FindSubTags returns the matching node itself, of whatever type it is, nil when none matches, and how many
+// nodes were visited. The first match in preorder is returned, no matter in which order workers reach matching
+// nodes. All goroutines of the search are finished when it returns, also when ctx is canceled.
+func (s *Searcher) FindSubTags(ctx context.Context, node GNode, tag string) (GNode, int) {
+	ctx, span := tracing.Start(ctx, "GetSubTags")
+	defer span.End()
+	span.SetAttribute("tag", tag)
+	search := &search{searcher: s, tag: tag}
+	group, groupCtx := NewGroup(ctx, s.pool)
+	search.group = group
+	// HINT: the root is searched in our goroutine, only wide nodes hand their children to the pool
+	if _, err := search.lookupChildrens(groupCtx, node, nil); err != nil {
+		group.fail(err)
+	}
+	// HINT: Wait returns once every task finished, nothing of the search outlives this call
+	err := group.Wait()
+	visited := int(atomic.LoadInt64(&search.visited))
+	best := search.best.Load()
+	if err != nil || best == nil {
+		return nil, visited
+	}
+	return best.node, visited
+}
+
+// search is the state shared by all tasks of one LookupSubTags call.
+type search struct {
+	searcher *Searcher
+	group    *Group
+	tag      string
+	visited  int64
+	mutex    sync.Mutex
+	// best is the match earliest in preorder found so far
+	best atomic.Pointer[match]
+}
+
+// match is a matching node and its position, the indexes of children on the way from the root.
+// HINT: positions compare lexicographically in the same order as preorder, an ancestor comes before its subtree
+type match struct {
+	position []int
+	node     GNode
+}
+
+// offer keeps the match when it comes before the best one so far.
+func (s *search) offer(position []int, node GNode) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if best := s.best.Load(); best == nil || slices.Compare(position, best.position) < 0 {
+		s.best.Store(&match{position: slices.Clone(position), node: node})
+	}
+}
+
+// pruned reports whether a match before the position is already known, so the subtree at it cannot win.
+func (s *search) pruned(position []int) bool {
+	best := s.best.Load()
+	return best != nil && slices.Compare(best.position, position) < 0
+}
+
+// lookupChildrens performs a recursive search for a specific tag within a node at the position and its children,
+// utilizing the shared pool for improved performance in the hot spot section.
+// It returns true when the subtree was searched sequentially and a match was offered, so the caller can stop.
+// Children of wide nodes are searched by tasks of the group, they offer their matches on their own.
+// Every examined node is counted in visited.
 // The ctx context is used for cancellation and termination.
-// Once all goroutines have completed, a signal is sent to the done channel.
-// HINT: only channels for writing as input parameters, method is not draining them.
-func lookupChildrens(ctx context.Context, innerCtx context.Context, node GNode, tag string, result chan<- MyNode, done chan<- struct{}, pool *Pool, active *int32) {
-	defer func() {
-		if atomic.AddInt32(active, -1) == 0 {
-			done <- struct{}{}
-		}
-	}()
+func (s *search) lookupChildrens(ctx context.Context, node GNode, position []int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if s.pruned(position) {
+		return false, nil
+	}
+	atomic.AddInt64(&s.visited, 1)
 
-	if node.GetName() == tag {
-		myNode, ok := node.(MyNode)
-		if !ok {
-			return
-		}
-		result <- myNode
-		return
-	}
-
-	if len(node.GetChildren()) >= 10 {
-		for _, child := range node.GetChildren() {
-			select {
-			case <-ctx.Done():
-				return
-			case <-innerCtx.Done():
-				return
-			default:
-				atomic.AddInt32(active, 1)
-				pool.Schedule(func() {
-					lookupChildrens(ctx, innerCtx, child, tag, result, done, pool, active)
-				})
-			}
+	if node.GetName() == s.tag {
+		s.offer(position, node)
+		return true, nil
+	}
+
+	if len(node.GetChildren()) >= s.searcher.config.ParallelThreshold {
+		for i, child := range node.GetChildren() {
+			// HINT: the closure runs later, it needs its own copies of the loop variable and of the position
+			child := child
+			childPosition := append(slices.Clone(position), i)
+			s.group.Go(func(ctx context.Context) error {
+				_, span := tracing.Start(ctx, "pool task")
+				defer span.End()
+				span.SetAttribute("node", child.GetName())
+				_, err := s.lookupChildrens(ctx, child, childPosition)
+				return err
+			})
 		}
-	} else {
-		for _, child := range node.GetChildren() {
-			atomic.AddInt32(active, 1)
-			lookupChildrens(ctx, innerCtx, child, tag, result, done, pool, active)
+		return false, nil
+	}
+	for i, child := range node.GetChildren() {
+		// HINT: children searched in this goroutine come in preorder, first match of the subtree wins
+		found, err := s.lookupChildrens(ctx, child, append(position, i))
+		if found || err != nil {
+			return found, err
 		}
 	}
+	return false, nil
 }
 
 var tokenCache = map[string]bool{
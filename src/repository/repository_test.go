@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// generateWideTree builds a tree whose root has width children, each of them with a full subtree
+// of the given fanout and depth. Names are unique and assigned in preorder, the last one is returned.
+func generateWideTree(width int, fanout int, depth int) (MyNode, string) {
+	counter := 0
+	var build func(level int) MyNode
+	build = func(level int) MyNode {
+		node := NewNode().SetName(fmt.Sprintf("n%d", counter))
+		counter++
+		if level < depth {
+			children := make([]GNode, 0, fanout)
+			for i := 0; i < fanout; i++ {
+				children = append(children, build(level+1))
+			}
+			node.SetChildren(children)
+		}
+		return *node
+	}
+	root := NewNode().SetName("root")
+	counter++
+	children := make([]GNode, 0, width)
+	for i := 0; i < width; i++ {
+		children = append(children, build(1))
+	}
+	return *root.SetChildren(children), fmt.Sprintf("n%d", counter-1)
+}
+
+func TestSearcherConfigs(t *testing.T) {
+	tree, last := generateWideTree(16, 3, 4)
+	configs := []SearchConfig{
+		{Workers: 1, ParallelThreshold: 10},
+		{Workers: 4, ParallelThreshold: 10},
+		{Workers: 4, ParallelThreshold: 1 << 30},
+		{Workers: 0, ParallelThreshold: 10},
+	}
+	for _, config := range configs {
+		t.Run(fmt.Sprintf("workers=%d threshold=%d", config.Workers, config.ParallelThreshold), func(t *testing.T) {
+			searcher := NewSearcher(config)
+			defer searcher.Close()
+			for _, tag := range []string{"root", "n1", last, "missing"} {
+				result := searcher.GetSubTags(context.Background(), tree, tag)
+				expected := tag
+				if tag == "missing" {
+					expected = ""
+				}
+				if result.GetName() != expected {
+					t.Errorf("Expected %q, but got %q", expected, result.GetName())
+				}
+			}
+		})
+	}
+}
+
+// Workers scheduling tasks of wide nodes under wide nodes used to block each other on a full queue.
+func TestSearcherNestedWideTree(t *testing.T) {
+	var build func(prefix string, depth int) MyNode
+	build = func(prefix string, depth int) MyNode {
+		node := NewNode().SetName(prefix)
+		if depth > 0 {
+			children := make([]GNode, 0, 12)
+			for i := 0; i < 12; i++ {
+				children = append(children, build(fmt.Sprintf("%s.%d", prefix, i), depth-1))
+			}
+			node.SetChildren(children)
+		}
+		return *node
+	}
+	tree := build("n", 3)
+	searcher := NewSearcher(SearchConfig{Workers: 2, QueueSize: 1, ParallelThreshold: 10})
+	defer searcher.Close()
+	for _, tag := range []string{"n.11.11.11", "n.0.5", "missing"} {
+		result, visited := searcher.LookupSubTags(context.Background(), tree, tag)
+		if tag == "missing" {
+			if result.GetName() != "" || visited != 1+12+144+1728 {
+				t.Errorf("Expected whole tree visited without match, but got %q after %d", result.GetName(), visited)
+			}
+			continue
+		}
+		if result.GetName() != tag {
+			t.Errorf("Expected %q, but got %q", tag, result.GetName())
+		}
+	}
+}
+
+func TestSearchKeepsGOMAXPROCS(t *testing.T) {
+	tree, last := generateWideTree(16, 2, 2)
+	before := runtime.GOMAXPROCS(0)
+	NewSearcher(DefaultSearchConfig()).GetSubTags(context.Background(), tree, last)
+	if after := runtime.GOMAXPROCS(0); after != before {
+		t.Errorf("Expected GOMAXPROCS %d to stay, but got %d", before, after)
+	}
+}
+
+// BenchmarkGetSubTags compares the search of the last tag in preorder, which visits the whole tree,
+// sequentially and with growing number of workers.
+func BenchmarkGetSubTags(b *testing.B) {
+	tree, last := generateWideTree(64, 5, 6)
+	configs := []struct {
+		name   string
+		config SearchConfig
+	}{
+		{name: "sequential", config: SearchConfig{Workers: 1, ParallelThreshold: 1 << 30}},
+		{name: "workers=1", config: SearchConfig{Workers: 1, ParallelThreshold: 10}},
+		{name: "workers=2", config: SearchConfig{Workers: 2, ParallelThreshold: 10}},
+		{name: "workers=4", config: SearchConfig{Workers: 4, ParallelThreshold: 10}},
+		{name: "workers=8", config: SearchConfig{Workers: 8, ParallelThreshold: 10}},
+		{name: "workers=NumCPU", config: DefaultSearchConfig()},
+	}
+	for _, c := range configs {
+		searcher := NewSearcher(c.config)
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				searcher.GetSubTags(context.Background(), tree, last)
+			}
+		})
+	}
+}
+
+// BenchmarkGetSubTagsParallelRequests simulates concurrent requests, the case where changing
+// GOMAXPROCS per request used to hurt.
+func BenchmarkGetSubTagsParallelRequests(b *testing.B) {
+	tree, last := generateWideTree(64, 4, 5)
+	for _, workers := range []int{1, 4, runtime.NumCPU()} {
+		searcher := NewSearcher(SearchConfig{Workers: workers, ParallelThreshold: 10})
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					searcher.GetSubTags(context.Background(), tree, last)
+				}
+			})
+		})
+	}
+}
+
+// Every duplicate is a node named dup with a single child telling its order in preorder.
+func TestSearcherPreorderFirstMatch(t *testing.T) {
+	duplicate := func(order string) GNode {
+		return *NewNode().SetName("dup").SetChildren([]GNode{*NewNode().SetName(order)})
+	}
+	wide := func(children ...GNode) []GNode {
+		// HINT: padding makes nodes wide enough to be searched in parallel
+		for len(children) < 12 {
+			children = append(children, *NewNode().SetName(fmt.Sprintf("pad%d", len(children))))
+		}
+		return children
+	}
+	deep, _ := generateWideTree(12, 3, 4)
+	tree := *NewNode().SetName("root").SetChildren(wide(
+		deep,
+		*NewNode().SetName("left").SetChildren(wide(*NewNode().SetName("inner").SetChildren([]GNode{duplicate("first")}))),
+		duplicate("second"),
+		*NewNode().SetName("right").SetChildren(wide(duplicate("third"), duplicate("fourth"))),
+	))
+
+	configs := []SearchConfig{
+		{Workers: 1, QueueSize: 0, ParallelThreshold: 10},
+		{Workers: 4, QueueSize: 1, ParallelThreshold: 10},
+		{Workers: 8, QueueSize: 64, ParallelThreshold: 1},
+		{Workers: 4, QueueSize: 64, ParallelThreshold: 1 << 30},
+	}
+	for _, config := range configs {
+		searcher := NewSearcher(config)
+		for i := 0; i < 50; i++ {
+			result := searcher.GetSubTags(context.Background(), tree, "dup")
+			if children := result.GetChildren(); len(children) != 1 || children[0].GetName() != "first" {
+				t.Fatalf("Expected first duplicate in preorder with %+v, but got %v", config, result)
+			}
+		}
+		searcher.Close()
+	}
+}
+
+func TestSearcherCancellation(t *testing.T) {
+	tree, last := generateWideTree(64, 4, 6)
+	searcher := NewSearcher(SearchConfig{Workers: 4, QueueSize: 8, ParallelThreshold: 10})
+	defer searcher.Close()
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result, visited := searcher.LookupSubTags(ctx, tree, "n1"); result.GetName() != "" || visited != 0 {
+		t.Errorf("Expected nothing searched with canceled context, but got %q after %d nodes", result.GetName(), visited)
+	}
+
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i)*100*time.Microsecond)
+		searcher.GetSubTags(ctx, tree, last)
+		cancel()
+		searcher.GetSubTags(context.Background(), tree, "n1")
+	}
+	checkNoLeaks(t, baseline)
+}
+
+// A closed pool used to fail the group of the search, so every tag looked missing.
+func TestSearcherAfterClose(t *testing.T) {
+	tree, last := generateWideTree(64, 4, 3)
+	searcher := NewSearcher(SearchConfig{Workers: 4, QueueSize: 8, ParallelThreshold: 2})
+	searcher.Close()
+	if found, _ := searcher.FindSubTags(context.Background(), tree, last); found == nil || found.GetName() != last {
+		t.Errorf("Expected %s to be found without workers, but got %v", last, found)
+	}
+	if found, _ := searcher.FindSubTags(context.Background(), tree, "missing"); found != nil {
+		t.Errorf("Expected nothing for missing tag, but got %v", found)
+	}
+}
+
+// checkNoLeaks fails when goroutines started by searches outlive them. Workers of the pool live on,
+// so baseline is taken once the searcher exists.
+// HINT: the default searcher starts its workers on first use, so tests counting goroutines search with their own searcher only
+func checkNoLeaks(t *testing.T, baseline int) {
+	t.Helper()
+	// HINT: goroutines finishing right now need a moment to be gone from the count
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if count := runtime.NumGoroutine(); count > baseline {
+		stacks := make([]byte, 1<<20)
+		stacks = stacks[:runtime.Stack(stacks, true)]
+		t.Errorf("Expected %d goroutines, but got %d:\n%s", baseline, count, stacks)
+	}
+}
+
+// Values JSON can not hold, e.g. NaN, fail the marshaling instead of writing broken JSON.
+func TestMarshalJSONErrors(t *testing.T) {
+	nan := math.NaN()
+	testCases := []struct {
+		name string
+		node MyNode
+	}{
+		{name: "Test weight", node: *NewNode().SetName("A").SetWeight(nan)},
+		{name: "Test attribute", node: *NewNode().SetName("A").SetAttributes(map[string]interface{}{"size": nan})},
+		{name: "Test child", node: *NewNode().SetName("A").SetChildren([]GNode{*NewNode().SetName("B").SetWeight(nan)})},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// HINT: json.Marshal would reject broken output of MarshalJSON itself, so it is called directly
+			if body, err := tc.node.MarshalJSON(); err == nil {
+				t.Errorf("Expected error, but got %s", body)
+			}
+			if body, err := NewTree(tc.node).MarshalJSON(); err == nil {
+				t.Errorf("Expected error for Tree, but got %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package repository
+
+// Transformations below build new immutable trees (*Tree) and leave the input as it is. They walk the tree
+// with an explicit stack, so a deep tree can not overflow the goroutine stack. Attributes are shared with the
+// input, as they must not be modified, Clone is the one copying them.
+
+// DepthNode is a node of a tree with its depth, the root has depth 0.
+type DepthNode struct {
+	Node  GNode
+	Depth int
+}
+
+// buildFrame is a node being rebuilt, children are built before their parent.
+type buildFrame struct {
+	node     GNode
+	depth    int
+	next     int
+	children []GNode
+}
+
+// rebuild builds a new tree bottom up. enter tells whether children of a node are visited at all,
+// leave builds the node from its built children and tells whether it is kept in its parent.
+func rebuild[T GNode](root GNode, enter func(node GNode, depth int) bool, leave func(node GNode, depth int, children []GNode) (T, bool)) (T, bool) {
+	if root == nil {
+		var zero T
+		return zero, false
+	}
+	stack := []*buildFrame{{node: root}}
+	for {
+		top := stack[len(stack)-1]
+		children := top.node.GetChildren()
+		// HINT: next is 0 only until the first child is visited, so enter is asked once per node
+		if top.next == 0 && !enter(top.node, top.depth) {
+			children = nil
+		}
+		if top.next < len(children) {
+			stack = append(stack, &buildFrame{node: children[top.next], depth: top.depth + 1})
+			top.next++
+			continue
+		}
+		built, keep := leave(top.node, top.depth, top.children)
+		stack = stack[:len(stack)-1]
+		if len(stack) == 0 {
+			return built, keep
+		}
+		if keep {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, built)
+		}
+	}
+}
+
+// copyOf returns the node as MyNode with its own children slice, other implementations of GNode
+// are copied by their name, weight and attributes.
+func copyOf(node GNode, children []GNode) MyNode {
+	var myNode MyNode
+	switch node := node.(type) {
+	case MyNode:
+		myNode = node
+	case *MyNode:
+		myNode = *node
+	default:
+		myNode = MyNode{name: node.GetName()}
+		if weighted, ok := node.(Weighted); ok && weighted.GetWeight() != 1 {
+			myNode.SetWeight(weighted.GetWeight())
+		}
+		if attributed, ok := node.(interface{ GetAttributes() map[string]interface{} }); ok {
+			myNode.attributes = attributed.GetAttributes()
+		}
+	}
+	return myNode.WithChildren(children)
+}
+
+func always(node GNode, depth int) bool {
+	return true
+}
+
+// Filter returns the tree of nodes for which keep is true together with their ancestors,
+// other nodes are left out with their subtrees. False is returned when no node is kept.
+func Filter(root GNode, keep func(node GNode) bool) (*Tree, bool) {
+	return rebuild(root, always, func(node GNode, depth int, children []GNode) (*Tree, bool) {
+		return treeNode(copyOf(node, nil), children), len(children) > 0 || keep(node)
+	})
+}
+
+// Prune returns the tree without nodes deeper than depth, Prune(root, 0) is the root alone.
+func Prune(root GNode, depth int) *Tree {
+	pruned, _ := rebuild(root, func(node GNode, level int) bool {
+		return level < depth
+	}, func(node GNode, level int, children []GNode) (*Tree, bool) {
+		return treeNode(copyOf(node, nil), children), true
+	})
+	return pruned
+}
+
+// MapTree returns the tree of the same shape with every node replaced by what fn returns for it,
+// e.g. node.WithName(strings.ToUpper(node.GetName())). Nodes are mapped bottom up, fn gets a copy of
+// the node without children, children of what it returns are ignored and the mapped ones are used.
+// HINT: it is not Map, as Map over slices is already taken by the pool
+func MapTree(root GNode, fn func(node MyNode, depth int) MyNode) *Tree {
+	mapped, _ := rebuild(root, always, func(node GNode, depth int, children []GNode) (*Tree, bool) {
+		return treeNode(fn(copyOf(node, nil), depth), children), true
+	})
+	return mapped
+}
+
+// Clone returns a deep copy of the tree, attributes included, which shares nothing with the input.
+func Clone(root GNode) *Tree {
+	clone, _ := rebuild(root, always, func(node GNode, depth int, children []GNode) (*Tree, bool) {
+		copied := copyOf(node, nil)
+		if copied.attributes != nil {
+			copied.attributes = cloneValue(copied.attributes).(map[string]interface{})
+		}
+		return treeNode(copied, children), true
+	})
+	return clone
+}
+
+// cloneValue copies objects and arrays of a value loaded from JSON, other values are immutable.
+func cloneValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, element := range value {
+			copied[key] = cloneValue(element)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, element := range value {
+			copied[i] = cloneValue(element)
+		}
+		return copied
+	}
+	return value
+}
+
+// Flatten returns nodes of the tree in preorder with their depths, nodes deeper than maxDepth are left out.
+// A negative maxDepth means all nodes.
+func Flatten(root GNode, maxDepth int) []DepthNode {
+	var nodes []DepthNode
+	if root == nil {
+		return nodes
+	}
+	stack := []DepthNode{{Node: root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		nodes = append(nodes, top)
+		if maxDepth >= 0 && top.Depth >= maxDepth {
+			continue
+		}
+		// HINT: children are pushed in reverse, so the first one is popped first
+		children := top.Node.GetChildren()
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, DepthNode{Node: children[i], Depth: top.Depth + 1})
+		}
+	}
+	return nodes
+}
+
+// toMyNode returns the node as MyNode, other implementations of GNode are copied with their subtree.
+func toMyNode(node GNode) MyNode {
+	if myNode, ok := node.(MyNode); ok {
+		return myNode
+	}
+	converted, _ := rebuild(node, always, func(node GNode, depth int, children []GNode) (MyNode, bool) {
+		return copyOf(node, children), true
+	})
+	return converted
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// transformTree is A(B(E F) C(G H) D) with attributes on B.
+func transformTree() MyNode {
+	return *NewNode().SetName("A").SetChildren([]GNode{
+		*NewNode().SetName("B").SetAttributes(map[string]interface{}{"aliases": []interface{}{"b"}}).SetChildren([]GNode{
+			*NewNode().SetName("E"),
+			*NewNode().SetName("F"),
+		}),
+		*NewNode().SetName("C").SetChildren([]GNode{
+			*NewNode().SetName("G"),
+			*NewNode().SetName("H"),
+		}),
+		*NewNode().SetName("D"),
+	})
+}
+
+// shape writes the tree as A(B(E F) C) with depth first order.
+func shape(node GNode) string {
+	children := node.GetChildren()
+	if len(children) == 0 {
+		return node.GetName()
+	}
+	var names []string
+	for _, child := range children {
+		names = append(names, shape(child))
+	}
+	return node.GetName() + "(" + strings.Join(names, " ") + ")"
+}
+
+func TestTransform(t *testing.T) {
+	tree := transformTree()
+	testCases := []struct {
+		name     string
+		actual   func() string
+		expected string
+	}{
+		{name: "Test filter", actual: func() string {
+			filtered, _ := Filter(tree, func(node GNode) bool { return node.GetName() == "F" || node.GetName() == "D" })
+			return shape(filtered)
+		}, expected: "A(B(F) D)"},
+		{name: "Test filter without match", actual: func() string {
+			_, found := Filter(tree, func(node GNode) bool { return false })
+			return fmt.Sprint(found)
+		}, expected: "false"},
+		{name: "Test prune", actual: func() string { return shape(Prune(tree, 1)) }, expected: "A(B C D)"},
+		{name: "Test prune root", actual: func() string { return shape(Prune(tree, 0)) }, expected: "A"},
+		{name: "Test map", actual: func() string {
+			return shape(MapTree(tree, func(node MyNode, depth int) MyNode {
+				return node.WithName(fmt.Sprintf("%s%d", strings.ToLower(node.GetName()), depth))
+			}))
+		}, expected: "a0(b1(e2 f2) c1(g2 h2) d1)"},
+		{name: "Test map keeps children", actual: func() string {
+			return shape(MapTree(tree, func(node MyNode, depth int) MyNode { return node.WithChildren(nil) }))
+		}, expected: "A(B(E F) C(G H) D)"},
+		{name: "Test flatten", actual: func() string {
+			var names []string
+			for _, node := range Flatten(tree, -1) {
+				names = append(names, fmt.Sprintf("%s%d", node.Node.GetName(), node.Depth))
+			}
+			return strings.Join(names, " ")
+		}, expected: "A0 B1 E2 F2 C1 G2 H2 D1"},
+		{name: "Test flatten to depth", actual: func() string {
+			var names []string
+			for _, node := range Flatten(tree, 1) {
+				names = append(names, node.Node.GetName())
+			}
+			return strings.Join(names, " ")
+		}, expected: "A B C D"},
+		{name: "Test clone", actual: func() string { return shape(Clone(tree)) }, expected: "A(B(E F) C(G H) D)"},
+		{name: "Test input kept", actual: func() string { return shape(tree) }, expected: "A(B(E F) C(G H) D)"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.actual(); actual != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+// Transformations must not touch the input, Clone must not even share attributes with it.
+func TestTransformImmutable(t *testing.T) {
+	tree := transformTree()
+	clone := Clone(tree)
+	clone.Child(0).GetAttributes()["aliases"].([]interface{})[0] = "changed"
+	if alias := tree.GetChildren()[0].(MyNode).GetAttributes()["aliases"].([]interface{})[0]; alias != "b" {
+		t.Errorf("Expected alias of the input b, but got %v", alias)
+	}
+
+	// results are trees of their own, neither editing them nor writing into their children reaches the input
+	pruned := Prune(tree, 1)
+	renamed, err := pruned.Rename([]int{0}, "X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned.GetChildren()[1] = TreeOf("Y")
+	if shape(tree) != "A(B(E F) C(G H) D)" || shape(renamed) != "A(X C D)" {
+		t.Errorf("Expected input A(B(E F) C(G H) D) and edit A(X C D), but got %s and %s", shape(tree), shape(renamed))
+	}
+	filtered, _ := Filter(tree, func(node GNode) bool { return node.GetName() == "E" })
+	if _, err := filtered.Insert([]int{0}, -1, TreeOf("Z")); err != nil || shape(filtered) != "A(B(E))" {
+		t.Errorf("Expected filtered A(B(E)) to stay, but got %s and %v", shape(filtered), err)
+	}
+}
+
+// A chain deeper than any recursion would handle is transformed without growing the goroutine stack.
+func TestTransformDeep(t *testing.T) {
+	const depth = 1_000_000
+	var node GNode = *NewNode().SetName("leaf")
+	for i := 0; i < depth; i++ {
+		node = MyNode{name: "node", children: []GNode{node}}
+	}
+	if nodes := Flatten(Clone(node), -1); len(nodes) != depth+1 || nodes[depth].Depth != depth {
+		t.Errorf("Expected %d nodes, but got %d", depth+1, len(nodes))
+	}
+	if pruned := Flatten(Prune(node, 10), -1); len(pruned) != 11 {
+		t.Errorf("Expected 11 nodes, but got %d", len(pruned))
+	}
+}
@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Tree is a persistent (copy-on-write) tree node. Nothing of a Tree changes once it is created: an edit
+// returns a new root which shares all unchanged subtrees with the old one, only nodes on the path from
+// the root to the edited node are copied. Goroutines reading an old root are never disturbed by edits,
+// so a tree can be read concurrently while new versions of it are made.
+// HINT: unlike MyNode, whose copies share and mutate the same slice of children, a Tree is always used by pointer
+type Tree struct {
+	name       string
+	weight     float64
+	weighted   bool
+	attributes map[string]interface{}
+	// children are all *Tree, the slice is never written after the node was created
+	children []GNode
+	// size is the number of nodes in the subtree
+	size int
+}
+
+// NewTree returns a Tree with the same names, weights, attributes and shape as the node.
+// The node is walked with an explicit stack, so any depth is fine. A nil node gives a nil Tree.
+func NewTree(node GNode) *Tree {
+	if tree, ok := node.(*Tree); ok {
+		return tree
+	}
+	tree, _ := rebuild(node, always, func(node GNode, depth int, children []GNode) (*Tree, bool) {
+		return treeNode(copyOf(node, nil), children), true
+	})
+	return tree
+}
+
+// treeNode creates a Tree node with the name, weight and attributes of the node and the children, all *Tree.
+func treeNode(node MyNode, children []GNode) *Tree {
+	return &Tree{
+		name:       node.name,
+		weight:     node.weight,
+		weighted:   node.weighted,
+		attributes: node.attributes,
+		children:   children,
+		size:       treeSize(children),
+	}
+}
+
+// TreeOf creates a node with the name and the children.
+func TreeOf(name string, children ...*Tree) *Tree {
+	nodes := make([]GNode, len(children))
+	for i, child := range children {
+		nodes[i] = child
+	}
+	return &Tree{name: name, children: nodes, size: treeSize(nodes)}
+}
+
+func treeSize(children []GNode) int {
+	size := 1
+	for _, child := range children {
+		size += child.(*Tree).size
+	}
+	return size
+}
+
+// GetName returns the name, empty for a nil Tree.
+func (t *Tree) GetName() string {
+	if t == nil {
+		return ""
+	}
+	return t.name
+}
+
+// GetChildren returns the children, all of them are *Tree. The slice is shared by all readers and must
+// not be modified, it is clipped so appending to it copies it.
+func (t *Tree) GetChildren() []GNode {
+	if t == nil {
+		return nil
+	}
+	return slices.Clip(t.children)
+}
+
+// GetWeight returns the weight of the edge from the parent, 1 when none was set.
+func (t *Tree) GetWeight() float64 {
+	if t == nil || !t.weighted {
+		return 1
+	}
+	return t.weight
+}
+
+// GetAttributes returns metadata of the node, the map must not be modified.
+func (t *Tree) GetAttributes() map[string]interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.attributes
+}
+
+// Size returns the number of nodes in the subtree, the node included.
+func (t *Tree) Size() int {
+	if t == nil {
+		return 0
+	}
+	return t.size
+}
+
+// Child returns the child at the index.
+func (t *Tree) Child(index int) *Tree {
+	return t.children[index].(*Tree)
+}
+
+// MarshalJSON writes the tree as MyNode does, without copying it.
+func (t *Tree) MarshalJSON() ([]byte, error) {
+	var children []GNode
+	if len(t.children) > 0 {
+		children = t.children
+	}
+	return marshalTag(t.name, t.weight, t.weighted, t.attributes, children)
+}
+
+// WithName returns a copy of the node with another name, it shares the children.
+func (t *Tree) WithName(name string) *Tree {
+	copied := *t
+	copied.name = name
+	return &copied
+}
+
+// WithAttributes returns a copy of the node with other attributes, it shares the children.
+func (t *Tree) WithAttributes(attributes map[string]interface{}) *Tree {
+	copied := *t
+	copied.attributes = attributes
+	return &copied
+}
+
+// withChildren returns a copy of the node with other children.
+func (t *Tree) withChildren(children []GNode) *Tree {
+	copied := *t
+	copied.children = children
+	copied.size = treeSize(children)
+	return &copied
+}
+
+// At returns the node at the path, the indexes of children on the way from this node.
+func (t *Tree) At(path []int) (*Tree, error) {
+	node := t
+	for depth, index := range path {
+		if index < 0 || index >= len(node.children) {
+			return nil, fmt.Errorf("node %s at depth %d has no child %d", node.name, depth, index)
+		}
+		node = node.Child(index)
+	}
+	return node, nil
+}
+
+// Find returns the path to the first node with the name in preorder.
+func (t *Tree) Find(name string) ([]int, bool) {
+	type frame struct {
+		node *Tree
+		next int
+	}
+	if t.GetName() == name {
+		return []int{}, true
+	}
+	stack := []frame{{node: t}}
+	var path []int
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next == len(top.node.children) {
+			stack = stack[:len(stack)-1]
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+			continue
+		}
+		child := top.node.Child(top.next)
+		path = append(path, top.next)
+		top.next++
+		if child.name == name {
+			return path, true
+		}
+		stack = append(stack, frame{node: child})
+	}
+	return nil, false
+}
+
+// Update returns a new root with the node at the path replaced by what fn returns for it.
+// Only the nodes on the path are copied, every other subtree is shared with this tree.
+func (t *Tree) Update(path []int, fn func(node *Tree) (*Tree, error)) (*Tree, error) {
+	ancestors := make([]*Tree, 0, len(path))
+	node := t
+	for depth, index := range path {
+		if index < 0 || index >= len(node.children) {
+			return nil, fmt.Errorf("node %s at depth %d has no child %d", node.name, depth, index)
+		}
+		ancestors = append(ancestors, node)
+		node = node.Child(index)
+	}
+	updated, err := fn(node)
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		return nil, fmt.Errorf("node %s can not be replaced by nothing", node.name)
+	}
+	for depth := len(ancestors) - 1; depth >= 0; depth-- {
+		children := slices.Clone(ancestors[depth].children)
+		children[path[depth]] = updated
+		updated = ancestors[depth].withChildren(children)
+	}
+	return updated, nil
+}
+
+// Rename returns a new root with the node at the path renamed.
+func (t *Tree) Rename(path []int, name string) (*Tree, error) {
+	return t.Update(path, func(node *Tree) (*Tree, error) {
+		return node.WithName(name), nil
+	})
+}
+
+// Insert returns a new root with the child added under the node at the path at the index,
+// an index of -1 appends it after the other children.
+func (t *Tree) Insert(path []int, index int, child *Tree) (*Tree, error) {
+	if child == nil {
+		return nil, fmt.Errorf("no node to insert")
+	}
+	return t.Update(path, func(node *Tree) (*Tree, error) {
+		if index == -1 {
+			index = len(node.children)
+		}
+		if index < 0 || index > len(node.children) {
+			return nil, fmt.Errorf("node %s has %d children, can not insert at %d", node.name, len(node.children), index)
+		}
+		return node.withChildren(slices.Insert(slices.Clone(node.children), index, GNode(child))), nil
+	})
+}
+
+// Remove returns a new root without the node at the path and its subtree. The root itself can not be removed.
+func (t *Tree) Remove(path []int) (*Tree, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("root can not be removed")
+	}
+	last := path[len(path)-1]
+	return t.Update(path[:len(path)-1], func(node *Tree) (*Tree, error) {
+		if last < 0 || last >= len(node.children) {
+			return nil, fmt.Errorf("node %s has no child %d", node.name, last)
+		}
+		return node.withChildren(slices.Delete(slices.Clone(node.children), last, last+1)), nil
+	})
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	source := transformTree()
+	tree := NewTree(source)
+	if tree.Size() != 8 || shape(tree) != shape(source) {
+		t.Fatalf("Expected tree of 8 nodes %s, but got %d nodes %s", shape(source), tree.Size(), shape(tree))
+	}
+
+	testCases := []struct {
+		name          string
+		edit          func() (*Tree, error)
+		expected      string
+		expectedSize  int
+		expectedError bool
+	}{
+		{name: "Test rename", edit: func() (*Tree, error) { return tree.Rename([]int{1, 0}, "X") }, expected: "A(B(E F) C(X H) D)", expectedSize: 8},
+		{name: "Test insert", edit: func() (*Tree, error) { return tree.Insert([]int{2}, 0, TreeOf("X", TreeOf("Y"))) }, expected: "A(B(E F) C(G H) D(X(Y)))", expectedSize: 10},
+		{name: "Test insert first", edit: func() (*Tree, error) { return tree.Insert(nil, 0, TreeOf("X")) }, expected: "A(X B(E F) C(G H) D)", expectedSize: 9},
+		{name: "Test append", edit: func() (*Tree, error) { return tree.Insert([]int{0}, -1, TreeOf("X")) }, expected: "A(B(E F X) C(G H) D)", expectedSize: 9},
+		{name: "Test remove", edit: func() (*Tree, error) { return tree.Remove([]int{0}) }, expected: "A(C(G H) D)", expectedSize: 5},
+		{name: "Test remove root", edit: func() (*Tree, error) { return tree.Remove(nil) }, expectedError: true},
+		{name: "Test wrong path", edit: func() (*Tree, error) { return tree.Rename([]int{3}, "X") }, expectedError: true},
+		{name: "Test wrong index", edit: func() (*Tree, error) { return tree.Insert([]int{0}, 5, TreeOf("X")) }, expectedError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			edited, err := tc.edit()
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Expected error %v, but got %v", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if shape(edited) != tc.expected || edited.Size() != tc.expectedSize {
+				t.Errorf("Expected %s of %d nodes, but got %s of %d nodes", tc.expected, tc.expectedSize, shape(edited), edited.Size())
+			}
+			if shape(tree) != "A(B(E F) C(G H) D)" || tree.Size() != 8 {
+				t.Errorf("Expected the edited tree to stay as it was, but got %s", shape(tree))
+			}
+		})
+	}
+}
+
+// An edit copies only the path to the edited node, other subtrees are the same nodes in both versions.
+func TestTreeSharing(t *testing.T) {
+	tree := NewTree(transformTree())
+	renamed, err := tree.Rename([]int{1, 0}, "X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed == tree || renamed.Child(1) == tree.Child(1) {
+		t.Error("Expected nodes on the path to be copied")
+	}
+	if renamed.Child(0) != tree.Child(0) || renamed.Child(2) != tree.Child(2) || renamed.Child(1).Child(1) != tree.Child(1).Child(1) {
+		t.Error("Expected subtrees off the path to be shared")
+	}
+
+	// appending to children returned by a reader must not change the tree
+	children := tree.GetChildren()
+	_ = append(children, TreeOf("X"))
+	if len(tree.GetChildren()) != 3 {
+		t.Errorf("Expected 3 children, but got %d", len(tree.GetChildren()))
+	}
+}
+
+func TestTreeFind(t *testing.T) {
+	tree := NewTree(transformTree())
+	for name, expected := range map[string][]int{"A": {}, "F": {0, 1}, "H": {1, 1}, "D": {2}} {
+		path, ok := tree.Find(name)
+		if !ok || len(path) != len(expected) {
+			t.Fatalf("Expected path %v to %s, but got %v", expected, name, path)
+		}
+		for i := range path {
+			if path[i] != expected[i] {
+				t.Errorf("Expected path %v to %s, but got %v", expected, name, path)
+			}
+		}
+		if node, err := tree.At(path); err != nil || node.GetName() != name {
+			t.Errorf("Expected node %s at %v, but got %v", name, path, node.GetName())
+		}
+	}
+	if _, ok := tree.Find("X"); ok {
+		t.Error("Expected X not to be found")
+	}
+}
+
+// A Tree is searched and marshaled as the MyNode it was made of.
+func TestTreeAsMyNode(t *testing.T) {
+	source := transformTree()
+	tree := NewTree(source)
+	expected, err := json.Marshal(&source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(actual) != string(expected) {
+		t.Errorf("Expected %s, but got %s", expected, actual)
+	}
+
+	subtags := GetSubTags(context.Background(), tree, "B")
+	if shape(subtags) != "B(E F)" || subtags.GetAttributes()["aliases"] == nil {
+		t.Errorf("Expected B(E F) with aliases, but got %s with %v", shape(subtags), subtags.GetAttributes())
+	}
+	// the server gets the subtree itself, not a copy of it
+	if found, _ := FindSubTags(context.Background(), tree, "B"); found != tree.Child(0) {
+		t.Errorf("Expected B of the tree, but got %v", found)
+	}
+	if found, _ := FindSubTags(context.Background(), tree, "X"); found != nil {
+		t.Errorf("Expected nothing for X, but got %v", found)
+	}
+}
@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans somewhere.
+type Exporter interface {
+	Export(spans []SpanData) error
+}
+
+// WriterExporter writes every span as one JSON line, e.g. to stdout.
+type WriterExporter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func NewWriterExporter(writer io.Writer) *WriterExporter {
+	return &WriterExporter{writer: writer}
+}
+
+func (e *WriterExporter) Export(spans []SpanData) error {
+	type line struct {
+		Name       string            `json:"name"`
+		TraceID    string            `json:"traceId"`
+		SpanID     string            `json:"spanId"`
+		ParentID   string            `json:"parentSpanId,omitempty"`
+		Start      time.Time         `json:"start"`
+		Duration   string            `json:"duration"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+		Error      string            `json:"error,omitempty"`
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	encoder := json.NewEncoder(e.writer)
+	for _, span := range spans {
+		l := line{
+			Name:       span.Name,
+			TraceID:    span.TraceID.String(),
+			SpanID:     span.SpanID.String(),
+			Start:      span.Start,
+			Duration:   span.End.Sub(span.Start).String(),
+			Attributes: span.Attributes,
+		}
+		if span.ParentID != (SpanID{}) {
+			l.ParentID = span.ParentID.String()
+		}
+		if span.Error != nil {
+			l.Error = span.Error.Error()
+		}
+		if err := encoder.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OTLPExporter posts spans to an OpenTelemetry collector using OTLP over HTTP with JSON encoding.
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+}
+
+// NewOTLPExporter creates exporter for the collector at endpoint, e.g. http://localhost:4318.
+// Spans are posted to endpoint/v1/traces on behalf of the service.
+func NewOTLPExporter(endpoint string, service string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Field names follow the OTLP JSON mapping of the protobuf, ids are hex encoded in it.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	// Code is 0 unset, 1 ok and 2 error.
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, otlpAttribute{Key: key, Value: otlpValue{StringValue: attributes[key]}})
+	}
+	return result
+}
+
+func (e *OTLPExporter) Export(spans []SpanData) error {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+		}
+		if span.ParentID != (SpanID{}) {
+			s.ParentSpanID = span.ParentID.String()
+		}
+		if span.Error != nil {
+			s.Status = otlpStatus{Code: 2, Message: span.Error.Error()}
+		}
+		converted = append(converted, s)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]string{"service.name": e.service})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/landrisek/cisco"}, Spans: converted}},
+	}}})
+	if err != nil {
+		return err
+	}
+	response, err := e.client.Post(e.endpoint+"/v1/traces", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,347 @@
+// Package tracing records spans of work done for a request and exports them to stdout or an
+// OpenTelemetry collector. Trace context travels between services in the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the W3C Trace Context header carrying the parent span.
+const TraceparentHeader = "traceparent"
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Valid reports whether both IDs are set, all zero IDs are invalid by the specification.
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats the span context as value of the traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses the value of the traceparent header.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	// HINT: version 00 has exactly four parts, future versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return sc, fmt.Errorf("invalid trace id in traceparent %q", value)
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.SpanID) {
+		return sc, fmt.Errorf("invalid span id in traceparent %q", value)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, fmt.Errorf("invalid flags in traceparent %q", value)
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.Valid() {
+		return sc, fmt.Errorf("zero ids in traceparent %q", value)
+	}
+	return sc, nil
+}
+
+// Extract returns the remote parent span carried in the headers.
+func Extract(header http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	return sc, err == nil
+}
+
+// Inject writes the span of the ctx to the headers, so the next service continues the trace.
+func Inject(ctx context.Context, header http.Header) {
+	if span := FromContext(ctx); span != nil && span.context.Valid() {
+		header.Set(TraceparentHeader, span.context.Traceparent())
+	}
+}
+
+// SpanKind tells the role of a span, values follow OpenTelemetry.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+)
+
+// Span is a timed operation. A nil *Span is valid and records nothing, so callers never check.
+type Span struct {
+	tracer     *Tracer
+	name       string
+	kind       SpanKind
+	context    SpanContext
+	parent     SpanID
+	start      time.Time
+	end        time.Time
+	mutex      sync.Mutex
+	attributes map[string]string
+	err        error
+	ended      bool
+}
+
+// SpanContext returns the identity of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute annotates the span.
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.err = err
+}
+
+// End finishes the span and hands it to the exporter when the trace is sampled. Only first call counts.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mutex.Unlock()
+	if s.context.Sampled && s.tracer != nil {
+		s.tracer.record(s.data())
+	}
+}
+
+// SpanData is a finished span as exporters see it.
+type SpanData struct {
+	Name       string
+	Kind       SpanKind
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Error      error
+}
+
+func (s *Span) data() SpanData {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	attributes := make(map[string]string, len(s.attributes))
+	for key, value := range s.attributes {
+		attributes[key] = value
+	}
+	return SpanData{
+		Name:       s.name,
+		Kind:       s.kind,
+		TraceID:    s.context.TraceID,
+		SpanID:     s.context.SpanID,
+		ParentID:   s.parent,
+		Start:      s.start,
+		End:        s.end,
+		Attributes: attributes,
+		Error:      s.err,
+	}
+}
+
+type spanKey struct{}
+
+// FromContext returns the span carried by the ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start begins a child of the span carried by ctx, using the tracer of that span.
+// Without a span in ctx nothing is traced and a nil span is returned.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil || parent.tracer == nil {
+		return ctx, nil
+	}
+	return parent.tracer.start(ctx, name, KindInternal, parent.context)
+}
+
+// Tracer creates spans and batches finished ones for its exporter.
+type Tracer struct {
+	// ErrorHandler is called with errors of exports running in background, they are dropped when nil.
+	ErrorHandler func(error)
+	exporter     Exporter
+	batchSize    int
+	mutex        sync.Mutex
+	batch        []SpanData
+	// full wakes the background flusher once the batch reaches batchSize
+	full      chan struct{}
+	stop      chan struct{}
+	closeOnce sync.Once
+	stopped   sync.WaitGroup
+}
+
+// NewTracer creates a tracer exporting spans in batches of batchSize, or every interval at latest.
+// Exports run in a background goroutine, never in the one ending a span.
+func NewTracer(exporter Exporter, batchSize int, interval time.Duration) *Tracer {
+	tracer := &Tracer{
+		exporter:  exporter,
+		batchSize: batchSize,
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+	tracer.stopped.Add(1)
+	go tracer.flushEvery(interval)
+	return tracer
+}
+
+// StartServer begins a server span for the incoming request, continuing the trace of the caller
+// when the request carries a valid traceparent.
+func (t *Tracer) StartServer(ctx context.Context, name string, header http.Header) (context.Context, *Span) {
+	remote, ok := Extract(header)
+	if !ok {
+		// HINT: we sample every trace we start, callers decide for the traces they started
+		remote = SpanContext{TraceID: newTraceID(), Sampled: true}
+	}
+	return t.start(ctx, name, KindServer, remote)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		context: SpanContext{
+			TraceID: parent.TraceID,
+			SpanID:  newSpanID(),
+			Sampled: parent.Sampled,
+		},
+		parent: parent.SpanID,
+		start:  time.Now(),
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *Tracer) record(span SpanData) {
+	t.mutex.Lock()
+	t.batch = append(t.batch, span)
+	full := len(t.batch) >= t.batchSize
+	t.mutex.Unlock()
+	if full {
+		// HINT: the export is left to the background flusher, so ending a span never waits for the exporter
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush exports all finished spans now.
+func (t *Tracer) Flush() error {
+	t.mutex.Lock()
+	batch := t.batch
+	t.batch = nil
+	t.mutex.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	return t.exporter.Export(batch)
+}
+
+func (t *Tracer) flushEvery(interval time.Duration) {
+	defer t.stopped.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.handle(t.Flush())
+		case <-t.full:
+			t.handle(t.Flush())
+		}
+	}
+}
+
+func (t *Tracer) handle(err error) {
+	if err != nil && t.ErrorHandler != nil {
+		t.ErrorHandler(err)
+	}
+}
+
+// Close stops periodic exporting and flushes spans finished so far. It may be called more times.
+func (t *Tracer) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.stop)
+	})
+	t.stopped.Wait()
+	return t.Flush()
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
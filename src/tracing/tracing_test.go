@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name            string
+		value           string
+		expectedError   bool
+		expectedSampled bool
+	}{
+		{name: "sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expectedSampled: true},
+		{name: "not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{name: "future version with more fields", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", expectedSampled: true},
+		{name: "empty", value: "", expectedError: true},
+		{name: "forbidden version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expectedError: true},
+		{name: "extra field in version 00", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", expectedError: true},
+		{name: "short trace id", value: "00-4bf92f3577b34da6-00f067aa0ba902b7-01", expectedError: true},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", expectedError: true},
+		{name: "not hex", value: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", expectedError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tc.value)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Expected error %v, but got %v", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if sc.Sampled != tc.expectedSampled {
+				t.Errorf("Expected sampled %v, but got %v", tc.expectedSampled, sc.Sampled)
+			}
+			if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+				t.Errorf("Unexpected ids %s %s", sc.TraceID, sc.SpanID)
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var output bytes.Buffer
+	tracer := NewTracer(NewWriterExporter(&output), 100, time.Hour)
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, root := tracer.StartServer(context.Background(), "GET /taggedContent", header)
+	_, child := Start(ctx, "GetSubTags")
+	child.RecordError(errors.New("not found"))
+	child.End()
+	root.End()
+	root.End()
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var spans []map[string]interface{}
+	decoder := json.NewDecoder(&output)
+	for decoder.More() {
+		var span map[string]interface{}
+		if err := decoder.Decode(&span); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans exported once, but got %d", len(spans))
+	}
+	if spans[0]["name"] != "GetSubTags" || spans[0]["parentSpanId"] != root.SpanContext().SpanID.String() || spans[0]["error"] != "not found" {
+		t.Errorf("Unexpected child span %v", spans[0])
+	}
+	if spans[1]["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || spans[1]["parentSpanId"] != "00f067aa0ba902b7" {
+		t.Errorf("Expected root span to continue remote trace, but got %v", spans[1])
+	}
+
+	// without span in context nothing is traced
+	if _, span := Start(context.Background(), "orphan"); span != nil {
+		t.Errorf("Expected no span without parent, but got %v", span)
+	}
+}
+
+// blockingExporter receives batches on a channel, so the test decides when an export finishes.
+type blockingExporter struct {
+	batches chan []SpanData
+}
+
+func (e *blockingExporter) Export(spans []SpanData) error {
+	e.batches <- spans
+	return nil
+}
+
+// A full batch used to be exported by the goroutine ending the span, i.e. in the request.
+func TestTracerExportsInBackground(t *testing.T) {
+	exporter := &blockingExporter{batches: make(chan []SpanData)}
+	tracer := NewTracer(exporter, 2, time.Hour)
+	ctx, root := tracer.StartServer(context.Background(), "GET /taggedContent", http.Header{})
+	_, child := Start(ctx, "GetSubTags")
+
+	ended := make(chan struct{})
+	go func() {
+		child.End()
+		root.End()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected spans to end without waiting for the exporter")
+	}
+	if batch := <-exporter.batches; len(batch) != 2 {
+		t.Errorf("Expected full batch of 2 spans, but got %d", len(batch))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := tracer.Close(); err != nil {
+			t.Errorf("Expected close %d to succeed, but got %v", i+1, err)
+		}
+	}
+}